@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
@@ -12,14 +14,37 @@ import (
 
 var WIDGETS = []*widget.Widget{
 	widget.NewWindowTitleWidget(),
-	widget.NewWeatherWidget(),
-	widget.NewNetworkWidget(),
-	widget.NewMemoryWidget(),
-	widget.NewCpuWidget(),
-	widget.NewDateWidget(),
+	widget.NewWeatherWidget(widget.WeatherConfig{Lat: 59.91, Lon: 10.75, Provider: widget.WeatherNowcast}),
+	widget.NewNetworkWidget(widget.NetworkConfig{Throughput: true}),
+	widget.NewAudioWidget(widget.AudioConfig{}),
+	widget.NewBacklightWidget(widget.BacklightConfig{}),
+	widget.NewDiskWidget(widget.DiskConfig{}),
+	widget.NewMemoryWidget(widget.MemoryConfig{}),
+	widget.NewPressureWidget(widget.PressureConfig{LoadAverage: true}),
+	widget.NewCpuWidget(widget.CpuConfig{}),
+	widget.NewTemperatureWidget(widget.TemperatureConfig{}),
+	widget.NewBatteryWidget(widget.BatteryConfig{UPower: true}),
+	widget.NewTimerWidget(widget.TimerConfig{}),
+	widget.NewDateWidget(widget.DateConfig{}),
 }
 
 func main() {
+	// swaybar doesn't tell the status command which bar it belongs to, so it
+	// must be passed in the bar config, e.g. status_command statusbar -bar bar-0
+	barId := flag.String("bar", "", "sway bar id, enables per-output widget visibility")
+	command := flag.String("send", "", "send a command to a running statusbar, e.g. \"timer start\"")
+	flag.Parse()
+
+	if *command != "" {
+		reply, err := statusbar.SendCommand(*barId, *command)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(reply)
+		return
+	}
+
 	rand.Seed(time.Now().UnixNano())
 	log.SetFlags(log.Lmicroseconds)
 
@@ -32,6 +57,6 @@ func main() {
 
 	log.SetOutput(logFile)
 
-	sb := statusbar.NewStatusBar(WIDGETS)
+	sb := statusbar.NewStatusBar(WIDGETS, *barId)
 	sb.Run()
 }
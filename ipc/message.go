@@ -29,8 +29,8 @@ const (
 	EventBinding         MsgType = 1005
 	EventShutdown        MsgType = 1006
 	EventTick            MsgType = 1007
-	EventBarStateUpdate  MsgType = 1014
-	EventInput           MsgType = 1015
+	EventBarStateUpdate  MsgType = 1020
+	EventInput           MsgType = 1021
 )
 
 type Event string
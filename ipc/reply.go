@@ -0,0 +1,35 @@
+package ipc
+
+// BarConfig is the reply to GET_BAR_CONFIG and the payload of the
+// barconfig_update event
+type BarConfig struct {
+	Id            string   `json:"id"`
+	Mode          string   `json:"mode"`
+	HiddenState   string   `json:"hidden_state"`
+	Position      string   `json:"position"`
+	StatusCommand string   `json:"status_command"`
+	Outputs       []string `json:"outputs"`
+}
+
+// BarState is the payload of the bar_state_update event
+type BarState struct {
+	Id                string `json:"id"`
+	VisibleByModifier bool   `json:"visible_by_modifier"`
+}
+
+// WorkspaceInfo is a single entry in the reply to GET_WORKSPACES
+type WorkspaceInfo struct {
+	Num     int    `json:"num"`
+	Name    string `json:"name"`
+	Visible bool   `json:"visible"`
+	Focused bool   `json:"focused"`
+	Urgent  bool   `json:"urgent"`
+	Output  string `json:"output"`
+}
+
+// WorkspaceEvent is the payload of the workspace event
+type WorkspaceEvent struct {
+	Change  string         `json:"change"`
+	Current *WorkspaceInfo `json:"current"`
+	Old     *WorkspaceInfo `json:"old"`
+}
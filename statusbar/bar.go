@@ -0,0 +1,179 @@
+package statusbar
+
+import (
+	"log"
+	"sync"
+
+	"github.com/haakonleg/statusbar-sway/ipc"
+	"github.com/haakonleg/statusbar-sway/statusbar/widget"
+)
+
+// barState is what the statusbar knows about the sway bar it feeds
+type barState struct {
+	sync.Mutex
+	id                string
+	mode              string
+	outputs           []string
+	focusedOutput     string
+	visibleByModifier bool
+
+	ipcClient *ipc.SwayIpcClient
+}
+
+func newBarState(id string) *barState {
+	return &barState{id: id}
+}
+
+func (b *barState) setup() {
+	ipcClient, err := ipc.Connect()
+	if err != nil {
+		log.Fatalf("failed to connect to sway ipc protocol: %s", err.Error())
+	}
+	b.ipcClient = ipcClient
+}
+
+func (b *barState) close() {
+	if b.ipcClient != nil {
+		b.ipcClient.Close()
+	}
+}
+
+// run requests the bar config and focused output, and keeps them up to date.
+// redraw is called whenever something changed that affects visibility
+func (b *barState) run(redraw func()) {
+	if err := b.ipcClient.Send(ipc.NewMsg(ipc.GetBarConfig, []byte(b.id))); err != nil {
+		log.Fatalf("failed to send sway ipc command: %s", err.Error())
+	}
+
+	if err := b.ipcClient.Send(ipc.NewMsg(ipc.GetWorkspaces, []byte{})); err != nil {
+		log.Fatalf("failed to send sway ipc command: %s", err.Error())
+	}
+
+	if err := b.ipcClient.SubscribeEvent(ipc.BarconfigUpdate, ipc.BarStateUpdate, ipc.Workspace); err != nil {
+		log.Fatalf("failed to subscribe to event: %s", err.Error())
+	}
+
+	for {
+		msg := <-b.ipcClient.MsgQueue
+
+		if b.handleMsg(msg) {
+			redraw()
+		}
+	}
+}
+
+// handleMsg applies a sway reply or event to the state, and returns true if it changed
+func (b *barState) handleMsg(msg *ipc.Msg) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch msg.MsgType {
+	case ipc.GetBarConfig, ipc.EventBarconfigUpdate:
+		var config ipc.BarConfig
+		if err := msg.FromJson(&config); err != nil {
+			log.Printf("failed to parse bar config: %s", err.Error())
+			return false
+		}
+
+		if config.Id != b.id {
+			return false
+		}
+
+		log.Printf("bar %s: mode %s, outputs %v", config.Id, config.Mode, config.Outputs)
+		b.mode = config.Mode
+		b.outputs = config.Outputs
+		return true
+
+	case ipc.EventBarStateUpdate:
+		var state ipc.BarState
+		if err := msg.FromJson(&state); err != nil {
+			log.Printf("failed to parse bar state: %s", err.Error())
+			return false
+		}
+
+		if state.Id != b.id {
+			return false
+		}
+
+		b.visibleByModifier = state.VisibleByModifier
+		return true
+
+	case ipc.GetWorkspaces:
+		var workspaces []*ipc.WorkspaceInfo
+		if err := msg.FromJson(&workspaces); err != nil {
+			log.Printf("failed to parse workspaces: %s", err.Error())
+			return false
+		}
+
+		for _, ws := range workspaces {
+			if ws.Focused {
+				return b.setFocusedOutput(ws.Output)
+			}
+		}
+
+	case ipc.EventWorkspace:
+		var event ipc.WorkspaceEvent
+		if err := msg.FromJson(&event); err != nil {
+			log.Printf("failed to parse workspace event: %s", err.Error())
+			return false
+		}
+
+		if event.Change == "focus" && event.Current != nil {
+			return b.setFocusedOutput(event.Current.Output)
+		}
+	}
+
+	return false
+}
+
+func (b *barState) setFocusedOutput(output string) bool {
+	if output == b.focusedOutput {
+		return false
+	}
+	b.focusedOutput = output
+	return true
+}
+
+// hasOutput returns true if the bar is shown on the output. a bar without
+// outputs in its config is shown on all of them
+func (b *barState) hasOutput(output string) bool {
+	if len(b.outputs) == 0 {
+		return true
+	}
+
+	for _, o := range b.outputs {
+		if o == "*" || o == output {
+			return true
+		}
+	}
+	return false
+}
+
+// isVisible applies the visibility rules of a widget to the current bar state
+func (b *barState) isVisible(w *widget.Widget) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch w.Visibility {
+	case widget.VisibleFocusedOutput:
+		return b.focusedOutput == "" || b.hasOutput(b.focusedOutput)
+	}
+
+	return true
+}
+
+// shouldDraw returns false while a bar in hide mode is not shown, or in
+// invisible mode, there is no point in making swaybar render status lines
+// nobody can see
+func (b *barState) shouldDraw() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.mode {
+	case "invisible":
+		return false
+	case "hide":
+		return b.visibleByModifier
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package statusbar
+
+import (
+	"testing"
+
+	"github.com/haakonleg/statusbar-sway/ipc"
+	"github.com/haakonleg/statusbar-sway/statusbar/widget"
+)
+
+func TestBarStateHandleMsg(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *ipc.Msg
+		changed bool
+		// the state after the message
+		mode              string
+		outputs           []string
+		focusedOutput     string
+		visibleByModifier bool
+	}{
+		{
+			name:    "bar config",
+			msg:     ipc.NewMsg(ipc.GetBarConfig, []byte(`{"id": "bar-0", "mode": "dock", "outputs": ["DP-1"]}`)),
+			changed: true,
+			mode:    "dock", outputs: []string{"DP-1"},
+		},
+		{
+			name: "config of another bar",
+			msg:  ipc.NewMsg(ipc.EventBarconfigUpdate, []byte(`{"id": "bar-1", "mode": "hide", "outputs": ["HDMI-A-1"]}`)),
+			mode: "dock", outputs: []string{"DP-1"},
+		},
+		{
+			name: "invalid config",
+			msg:  ipc.NewMsg(ipc.EventBarconfigUpdate, []byte(`{"id": 5}`)),
+			mode: "dock", outputs: []string{"DP-1"},
+		},
+		{
+			name:    "focused workspace",
+			msg:     ipc.NewMsg(ipc.GetWorkspaces, []byte(`[{"name": "1", "output": "DP-1"}, {"name": "2", "focused": true, "output": "HDMI-A-1"}]`)),
+			changed: true,
+			mode:    "dock", outputs: []string{"DP-1"}, focusedOutput: "HDMI-A-1",
+		},
+		{
+			name: "focus on the same output",
+			msg:  ipc.NewMsg(ipc.EventWorkspace, []byte(`{"change": "focus", "current": {"name": "3", "output": "HDMI-A-1"}}`)),
+			mode: "dock", outputs: []string{"DP-1"}, focusedOutput: "HDMI-A-1",
+		},
+		{
+			name: "workspace change other than focus",
+			msg:  ipc.NewMsg(ipc.EventWorkspace, []byte(`{"change": "rename", "current": {"name": "3", "output": "DP-1"}}`)),
+			mode: "dock", outputs: []string{"DP-1"}, focusedOutput: "HDMI-A-1",
+		},
+		{
+			name:    "focus on another output",
+			msg:     ipc.NewMsg(ipc.EventWorkspace, []byte(`{"change": "focus", "current": {"name": "1", "output": "DP-1"}}`)),
+			changed: true,
+			mode:    "dock", outputs: []string{"DP-1"}, focusedOutput: "DP-1",
+		},
+		{
+			name:    "switched to hide mode",
+			msg:     ipc.NewMsg(ipc.EventBarconfigUpdate, []byte(`{"id": "bar-0", "mode": "hide", "outputs": ["DP-1"]}`)),
+			changed: true,
+			mode:    "hide", outputs: []string{"DP-1"}, focusedOutput: "DP-1",
+		},
+		{
+			name:    "modifier pressed",
+			msg:     ipc.NewMsg(ipc.EventBarStateUpdate, []byte(`{"id": "bar-0", "visible_by_modifier": true}`)),
+			changed: true,
+			mode:    "hide", outputs: []string{"DP-1"}, focusedOutput: "DP-1", visibleByModifier: true,
+		},
+		{
+			name: "modifier of another bar",
+			msg:  ipc.NewMsg(ipc.EventBarStateUpdate, []byte(`{"id": "bar-1", "visible_by_modifier": false}`)),
+			mode: "hide", outputs: []string{"DP-1"}, focusedOutput: "DP-1", visibleByModifier: true,
+		},
+	}
+
+	bar := newBarState("bar-0")
+	for _, test := range tests {
+		if changed := bar.handleMsg(test.msg); changed != test.changed {
+			t.Errorf("%s: changed %t, want %t", test.name, changed, test.changed)
+		}
+
+		if bar.mode != test.mode || bar.focusedOutput != test.focusedOutput || bar.visibleByModifier != test.visibleByModifier ||
+			len(bar.outputs) != len(test.outputs) || (len(bar.outputs) > 0 && bar.outputs[0] != test.outputs[0]) {
+			t.Errorf("%s: got mode %q outputs %v focused %q modifier %t", test.name,
+				bar.mode, bar.outputs, bar.focusedOutput, bar.visibleByModifier)
+		}
+	}
+}
+
+func TestBarStateShouldDraw(t *testing.T) {
+	tests := []struct {
+		mode              string
+		visibleByModifier bool
+		want              bool
+	}{
+		{"dock", false, true},
+		{"dock", true, true},
+		{"hide", false, false},
+		{"hide", true, true},
+		{"invisible", false, false},
+		{"invisible", true, false},
+		// before the bar config is received
+		{"", false, true},
+	}
+
+	for _, test := range tests {
+		bar := &barState{mode: test.mode, visibleByModifier: test.visibleByModifier}
+		if got := bar.shouldDraw(); got != test.want {
+			t.Errorf("mode %q modifier %t: got %t, want %t", test.mode, test.visibleByModifier, got, test.want)
+		}
+	}
+}
+
+func TestBarStateIsVisible(t *testing.T) {
+	always := widget.NewDateWidget(widget.DateConfig{})
+	focused := widget.NewWindowTitleWidget()
+
+	tests := []struct {
+		outputs       []string
+		focusedOutput string
+		want          bool
+	}{
+		{[]string{"DP-1"}, "DP-1", true},
+		{[]string{"DP-1"}, "HDMI-A-1", false},
+		{[]string{"*"}, "HDMI-A-1", true},
+		// a bar without outputs is on all of them
+		{nil, "HDMI-A-1", true},
+		// before the focused output is known
+		{[]string{"DP-1"}, "", true},
+	}
+
+	for _, test := range tests {
+		bar := &barState{outputs: test.outputs, focusedOutput: test.focusedOutput}
+		if !bar.isVisible(always) {
+			t.Errorf("outputs %v focused %q: widget without rules hidden", test.outputs, test.focusedOutput)
+		}
+		if got := bar.isVisible(focused); got != test.want {
+			t.Errorf("outputs %v focused %q: got %t, want %t", test.outputs, test.focusedOutput, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package statusbar
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/haakonleg/statusbar-sway/statusbar/widget"
+)
+
+// ControlSocketPath returns the path of the control socket, which is per bar
+// so several statusbars can run at once. without a runtime dir it is in a
+// directory of the user in the shared temp dir
+func ControlSocketPath(barId string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("statusbar-sway-%d", os.Getuid()))
+	}
+
+	name := "statusbar.sock"
+	if barId != "" {
+		name = fmt.Sprintf("statusbar-%s.sock", barId)
+	}
+	return filepath.Join(dir, name)
+}
+
+// SendCommand sends a command such as "timer start" to a running statusbar and returns the reply
+func SendCommand(barId string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", ControlSocketPath(barId), 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	reply = strings.TrimSuffix(reply, "\n")
+	if strings.HasPrefix(reply, "error ") {
+		return "", fmt.Errorf("%s", strings.TrimPrefix(reply, "error "))
+	}
+	return strings.TrimPrefix(reply, "ok "), nil
+}
+
+// controlSocket accepts commands for widgets, one per connection. a command is
+// a line with the widget name followed by its arguments, and the reply is a
+// line starting with ok or error
+type controlSocket struct {
+	path     string
+	listener net.Listener
+}
+
+func newControlSocket(barId string) *controlSocket {
+	return &controlSocket{path: ControlSocketPath(barId)}
+}
+
+func (c *controlSocket) setup() error {
+	if err := privateDir(filepath.Dir(c.path)); err != nil {
+		return err
+	}
+
+	// don't take over the socket of a running statusbar
+	if conn, err := net.DialTimeout("unix", c.path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another statusbar is listening on %s", c.path)
+	}
+
+	// left behind if the previous statusbar crashed
+	os.Remove(c.path)
+
+	listener, err := net.Listen("unix", c.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(c.path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+	c.listener = listener
+	return nil
+}
+
+// privateDir creates a directory only the user can access, and refuses one
+// that is owned by someone else or writable by other users, as it may have
+// been created in the shared temp dir by another user
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not a directory owned by the user", dir)
+	} else if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users", dir)
+	}
+	return nil
+}
+
+func (c *controlSocket) close() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func (c *controlSocket) run(widgets []*widget.Widget) {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			log.Printf("failed to accept control connection: %s", err.Error())
+			return
+		}
+
+		go c.handle(conn, widgets)
+	}
+}
+
+func (c *controlSocket) handle(conn net.Conn, widgets []*widget.Widget) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		fmt.Fprintln(conn, "error empty command")
+		return
+	}
+
+	log.Printf("command %s: %s", fields[0], strings.Join(fields[1:], " "))
+
+	// only the first widget with the name, so there is a single reply
+	for _, w := range widgets {
+		if w.Name != fields[0] {
+			continue
+		}
+
+		if reply, err := w.OnCommand(fields[1:]); err != nil {
+			fmt.Fprintf(conn, "error %s\n", err.Error())
+		} else {
+			fmt.Fprintf(conn, "ok %s\n", reply)
+		}
+		return
+	}
+
+	fmt.Fprintf(conn, "error no widget named %s\n", fields[0])
+}
@@ -0,0 +1,84 @@
+package statusbar
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestControlSocket(t *testing.T, barId string) *controlSocket {
+	t.Helper()
+
+	control := newControlSocket(barId)
+	if err := control.setup(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(control.close)
+	return control
+}
+
+func TestControlSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	control := newTestControlSocket(t, "bar-0")
+	go control.run(nil)
+
+	info, err := os.Stat(control.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode %s, want 0600", info.Mode().Perm())
+	}
+
+	if _, err := SendCommand("bar-0", "timer start"); err == nil || err.Error() != "no widget named timer" {
+		t.Errorf("got %v, want no widget named timer", err)
+	}
+
+	// a running statusbar is not taken over
+	if err := newControlSocket("bar-0").setup(); err == nil {
+		t.Error("took over the socket of a running statusbar")
+	}
+	if _, err := SendCommand("bar-0", "timer start"); err == nil || err.Error() != "no widget named timer" {
+		t.Errorf("got %v after a second statusbar started", err)
+	}
+}
+
+func TestControlSocketStale(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	// the socket of a crashed statusbar
+	listener, err := net.Listen("unix", ControlSocketPath(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	newTestControlSocket(t, "")
+}
+
+func TestControlSocketTempDir(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("TMPDIR", tmp)
+
+	dir := filepath.Join(tmp, "statusbar-sway-"+strconv.Itoa(os.Getuid()))
+	if path := ControlSocketPath(""); filepath.Dir(path) != dir {
+		t.Fatalf("got %s, want a socket in %s", path, dir)
+	}
+
+	newTestControlSocket(t, "").close()
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("got %v, %v, want a private directory", info, err)
+	}
+
+	// a directory others can write to may have been created by another user
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := newControlSocket("").setup(); err == nil {
+		t.Error("listened in a directory writable by other users")
+	}
+}
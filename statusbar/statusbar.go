@@ -15,9 +15,15 @@ type StatusBar struct {
 	state       []string
 	updateQueue chan []*widget.Update
 	stdout      *bufio.Writer
+
+	// bar is only set when the statusbar knows its bar id
+	bar     *barState
+	control *controlSocket
 }
 
-func NewStatusBar(widgets []*widget.Widget) *StatusBar {
+// NewStatusBar creates a statusbar for the widgets. if barId is set, the bar
+// config is used to apply the per-output visibility rules of the widgets
+func NewStatusBar(widgets []*widget.Widget, barId string) *StatusBar {
 	sb := &StatusBar{
 		widgets:     widgets,
 		state:       make([]string, len(widgets)),
@@ -25,6 +31,18 @@ func NewStatusBar(widgets []*widget.Widget) *StatusBar {
 		stdout:      bufio.NewWriter(os.Stdout),
 	}
 
+	if barId != "" {
+		sb.bar = newBarState(barId)
+		sb.bar.setup()
+	}
+
+	sb.control = newControlSocket(barId)
+	if err := sb.control.setup(); err != nil {
+		// widgets still work, only without commands
+		log.Printf("failed to listen on control socket: %s", err.Error())
+		sb.control = nil
+	}
+
 	for idx, widget := range widgets {
 		sb.state[idx] = "{}"
 		widget.Setup(sb.updateQueue)
@@ -43,6 +61,14 @@ func (s *StatusBar) Run() {
 		go widget.Run()
 	}
 
+	if s.bar != nil {
+		go s.bar.run(s.redraw)
+	}
+
+	if s.control != nil {
+		go s.control.run(s.widgets)
+	}
+
 	go s.updateLoop()
 	go s.readClickEvent()
 	s.mainLoop()
@@ -52,6 +78,19 @@ func (s *StatusBar) Run() {
 	for _, widget := range s.widgets {
 		widget.Close()
 	}
+
+	if s.bar != nil {
+		s.bar.close()
+	}
+
+	if s.control != nil {
+		s.control.close()
+	}
+}
+
+// redraw writes the current state again without updating any widget
+func (s *StatusBar) redraw() {
+	s.updateQueue <- []*widget.Update{}
 }
 
 // mainLoop receives update signals from the update queue and outputs json to stdout
@@ -62,22 +101,33 @@ func (s *StatusBar) mainLoop() {
 			return
 		}
 
-		s.stdout.WriteString("[")
+		// update json objects in state
 		for idx, w := range s.widgets {
-
-			// update json object in state
 			for _, update := range updates {
 				if update.Widget == w {
 					s.state[idx] = update.Json
 				}
 			}
+		}
 
-			// write json object
-			s.stdout.WriteString(s.state[idx])
+		if s.bar != nil && !s.bar.shouldDraw() {
+			continue
+		}
 
-			if idx < len(s.widgets)-1 {
+		s.stdout.WriteString("[")
+		first := true
+		for idx, w := range s.widgets {
+			if s.bar != nil && !s.bar.isVisible(w) {
+				continue
+			}
+
+			if !first {
 				s.stdout.WriteString(",")
 			}
+			first = false
+
+			// write json object
+			s.stdout.WriteString(s.state[idx])
 		}
 		s.stdout.WriteString("],\n")
 		s.stdout.Flush()
@@ -0,0 +1,328 @@
+package widget
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nf-md-volume
+const ICON_VOLUME_HIGH = '󰕾'
+const ICON_VOLUME_MEDIUM = '󰖀'
+const ICON_VOLUME_LOW = '󰕿'
+const ICON_VOLUME_OFF = '󰖁'
+
+// nf-md-microphone_off
+const ICON_MICROPHONE_OFF = '󰍭'
+
+type AudioConfig struct {
+	// Step is the volume change in percent per scroll step, defaults to 5
+	Step int
+	// MaxVolume is the highest volume that can be set by scrolling, defaults to 100
+	MaxVolume int
+}
+
+// audioState is the state of the default sink and source
+type audioState struct {
+	sink        string
+	volume      int
+	muted       bool
+	sourceMuted bool
+}
+
+// audioBackend is the sound server the widget talks to
+type audioBackend interface {
+	// setup fails if the backend can't reach the sound server
+	setup() error
+	close()
+	// subscribe sends to the channel whenever the sinks or sources may have changed.
+	// blocks until the connection to the sound server is lost
+	subscribe(changed chan<- struct{}) error
+	state() (*audioState, error)
+	// changeVolume changes the default sink volume by delta percent, up to max
+	changeVolume(delta int, max int) error
+	toggleMute() error
+	toggleSourceMute() error
+	// cycleSink makes the next sink the default
+	cycleSink() error
+}
+
+type Audio struct {
+	*Widget
+	config  AudioConfig
+	backend audioBackend
+	changed chan struct{}
+}
+
+func NewAudioWidget(config AudioConfig) *Widget {
+	return newAudioWidget(config, newPulseBackend())
+}
+
+func newAudioWidget(config AudioConfig, backend audioBackend) *Widget {
+	if config.Step == 0 {
+		config.Step = 5
+	}
+	if config.MaxVolume == 0 {
+		config.MaxVolume = 100
+	}
+
+	return newWidget("audio", -1, func(widget *Widget) impl {
+		return &Audio{
+			Widget:  widget,
+			config:  config,
+			backend: backend,
+			changed: make(chan struct{}, 1),
+		}
+	})
+}
+
+func (a *Audio) setup() {
+	if err := a.backend.setup(); err != nil {
+		log.Printf("failed to connect to sound server, falling back to pactl: %s", err.Error())
+		a.backend = &pactlBackend{}
+	}
+}
+
+func (a *Audio) close() {
+	a.backend.close()
+}
+
+func (a *Audio) run() {
+	go func() {
+		for {
+			if err := a.backend.subscribe(a.changed); err != nil {
+				log.Printf("lost connection to sound server: %s", err.Error())
+			}
+
+			// the sound server may be restarting
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	a.sendUpdate()
+	for range a.changed {
+		a.sendUpdate()
+	}
+}
+
+func (a *Audio) update(block *block) {
+	state, err := a.backend.state()
+	if err != nil {
+		log.Printf("failed to get audio state: %s", err.Error())
+		block.FullText = ""
+		return
+	}
+
+	icon := ICON_VOLUME_HIGH
+	if state.muted || state.volume == 0 {
+		icon = ICON_VOLUME_OFF
+	} else if state.volume < 33 {
+		icon = ICON_VOLUME_LOW
+	} else if state.volume < 66 {
+		icon = ICON_VOLUME_MEDIUM
+	}
+
+	block.FullText = fmt.Sprintf("%c %d%%", icon, state.volume)
+	if state.sourceMuted {
+		block.FullText = fmt.Sprintf("%c %s", ICON_MICROPHONE_OFF, block.FullText)
+	}
+	block.MinWidth = fmt.Sprintf("%c 100%%", icon)
+}
+
+// left click toggles mute, middle click toggles microphone mute,
+// right click switches to the next sink, scrolling changes volume
+func (a *Audio) onClick(x int, y int, btn int) {
+	var err error
+	switch btn {
+	case 1:
+		err = a.backend.toggleMute()
+	case 2:
+		err = a.backend.toggleSourceMute()
+	case 3:
+		err = a.backend.cycleSink()
+	case 4:
+		err = a.backend.changeVolume(a.config.Step, a.config.MaxVolume)
+	case 5:
+		err = a.backend.changeVolume(-a.config.Step, a.config.MaxVolume)
+	}
+
+	if err != nil {
+		log.Printf("failed to change audio state: %s", err.Error())
+	}
+}
+
+// pactlBackend talks to PulseAudio or pipewire-pulse through pactl. changes are
+// received from "pactl subscribe" rather than by polling
+type pactlBackend struct{}
+
+var pactlPercentRegex = regexp.MustCompile(`(\d+)%`)
+
+func (p *pactlBackend) setup() error {
+	return nil
+}
+
+func (p *pactlBackend) close() {}
+
+func (p *pactlBackend) subscribe(changed chan<- struct{}) error {
+	cmd := pactlCommand("subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer cmd.Wait()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// e.g. Event 'change' on sink #56
+		line := scanner.Text()
+		if !strings.Contains(line, "on sink #") && !strings.Contains(line, "on source #") &&
+			!strings.Contains(line, "on server") {
+			continue
+		}
+
+		// events come in bursts, one pending update is enough
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("pactl subscribe exited")
+}
+
+func (p *pactlBackend) state() (*audioState, error) {
+	state := &audioState{}
+	var err error
+
+	if state.sink, err = pactl("get-default-sink"); err != nil {
+		return nil, err
+	}
+
+	volume, err := pactl("get-sink-volume", "@DEFAULT_SINK@")
+	if err != nil {
+		return nil, err
+	}
+	state.volume = parsePactlVolume(volume)
+
+	if state.muted, err = pactlMute("get-sink-mute", "@DEFAULT_SINK@"); err != nil {
+		return nil, err
+	}
+
+	// a missing source is not an error, there's just nothing to show
+	state.sourceMuted, _ = pactlMute("get-source-mute", "@DEFAULT_SOURCE@")
+
+	return state, nil
+}
+
+func (p *pactlBackend) changeVolume(delta int, max int) error {
+	volume, err := pactl("get-sink-volume", "@DEFAULT_SINK@")
+	if err != nil {
+		return err
+	}
+
+	target := parsePactlVolume(volume) + delta
+	if target > max {
+		target = max
+	} else if target < 0 {
+		target = 0
+	}
+
+	_, err = pactl("set-sink-volume", "@DEFAULT_SINK@", strconv.Itoa(target)+"%")
+	return err
+}
+
+func (p *pactlBackend) toggleMute() error {
+	_, err := pactl("set-sink-mute", "@DEFAULT_SINK@", "toggle")
+	return err
+}
+
+func (p *pactlBackend) toggleSourceMute() error {
+	_, err := pactl("set-source-mute", "@DEFAULT_SOURCE@", "toggle")
+	return err
+}
+
+func (p *pactlBackend) cycleSink() error {
+	current, err := pactl("get-default-sink")
+	if err != nil {
+		return err
+	}
+
+	// e.g. 56	alsa_output.pci-0000_00_1f.3.analog-stereo	PipeWire	s32le 2ch 48000Hz	RUNNING
+	list, err := pactl("list", "short", "sinks")
+	if err != nil {
+		return err
+	}
+
+	sinks := make([]string, 0)
+	for _, line := range strings.Split(list, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 {
+			sinks = append(sinks, fields[1])
+		}
+	}
+	if len(sinks) < 2 {
+		return nil
+	}
+
+	next := sinks[0]
+	for idx, sink := range sinks {
+		if sink == current {
+			next = sinks[(idx+1)%len(sinks)]
+		}
+	}
+
+	_, err = pactl("set-default-sink", next)
+	return err
+}
+
+// pactlCommand runs pactl in the C locale, since its output is translated
+func pactlCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("pactl", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+func pactl(args ...string) (string, error) {
+	stdout, err := pactlCommand(args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("pactl %s: %s", args[0], err.Error())
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// pactlMute parses output such as "Mute: yes"
+func pactlMute(args ...string) (bool, error) {
+	out, err := pactl(args...)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(out, "yes"), nil
+}
+
+// parsePactlVolume returns the average of the channel volumes in output such as
+// "Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: 32768 /  50% / -18.06 dB"
+func parsePactlVolume(out string) int {
+	matches := pactlPercentRegex.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+
+	sum := 0
+	for _, match := range matches {
+		percent, _ := strconv.Atoi(match[1])
+		sum += percent
+	}
+	return sum / len(matches)
+}
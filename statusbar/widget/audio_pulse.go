@@ -0,0 +1,760 @@
+package widget
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// native protocol commands, from pulsecore/native-common.h
+const PA_COMMAND_ERROR = 0
+const PA_COMMAND_REPLY = 2
+const PA_COMMAND_AUTH = 8
+const PA_COMMAND_SET_CLIENT_NAME = 9
+const PA_COMMAND_GET_SERVER_INFO = 20
+const PA_COMMAND_GET_SINK_INFO = 21
+const PA_COMMAND_GET_SINK_INFO_LIST = 22
+const PA_COMMAND_GET_SOURCE_INFO = 23
+const PA_COMMAND_SUBSCRIBE = 35
+const PA_COMMAND_SET_SINK_VOLUME = 36
+const PA_COMMAND_SET_SINK_MUTE = 39
+const PA_COMMAND_SET_SOURCE_MUTE = 40
+const PA_COMMAND_SET_DEFAULT_SINK = 44
+const PA_COMMAND_SUBSCRIBE_EVENT = 66
+
+// subscription masks for sinks, sources and the server, which covers the default sink
+const PA_SUBSCRIPTION_MASK_SINK = 0x1
+const PA_SUBSCRIPTION_MASK_SOURCE = 0x2
+const PA_SUBSCRIPTION_MASK_SERVER = 0x80
+
+// the protocol version asked for, newer servers answer in this version
+const PULSE_PROTOCOL_VERSION = 32
+
+// proplists and the current sink info layout came with version 13
+const PULSE_MIN_PROTOCOL_VERSION = 13
+
+const PULSE_COOKIE_LENGTH = 256
+const PULSE_VOLUME_NORM = 0x10000
+const PULSE_INVALID_INDEX = 0xffffffff
+
+// packets on the control channel, as opposed to memblocks of a stream
+const PULSE_CONTROL_CHANNEL = 0xffffffff
+
+const PULSE_TIMEOUT = 5 * time.Second
+
+// pulseBackend talks to PulseAudio or pipewire-pulse over the native protocol.
+// requests share one connection, and changes are received on another
+type pulseBackend struct {
+	sync.Mutex
+	socket string
+	conn   *pulseConn
+	events *pulseConn
+}
+
+func newPulseBackend() *pulseBackend {
+	return &pulseBackend{socket: pulseSocketPath()}
+}
+
+func (p *pulseBackend) setup() error {
+	conn, err := dialPulse(p.socket)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	return nil
+}
+
+func (p *pulseBackend) close() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	if p.events != nil {
+		p.events.Close()
+	}
+}
+
+func (p *pulseBackend) subscribe(changed chan<- struct{}) error {
+	conn, err := dialPulse(p.socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	p.Lock()
+	p.events = conn
+	p.Unlock()
+
+	args := newPulseCommand(PA_COMMAND_SUBSCRIBE, conn.nextTag())
+	args.putU32(PA_SUBSCRIPTION_MASK_SINK | PA_SUBSCRIPTION_MASK_SOURCE | PA_SUBSCRIPTION_MASK_SERVER)
+	if _, err := conn.request(args); err != nil {
+		return err
+	}
+
+	// events are the only packets from here on, and don't time out
+	conn.SetDeadline(time.Time{})
+	for {
+		packet, err := conn.readPacket()
+		if err != nil {
+			return err
+		}
+
+		if command := packet.getU32(); packet.err == nil && command == PA_COMMAND_SUBSCRIBE_EVENT {
+			// events come in bursts, one pending update is enough
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (p *pulseBackend) state() (*audioState, error) {
+	sink, err := p.deviceInfo(PA_COMMAND_GET_SINK_INFO, "@DEFAULT_SINK@")
+	if err != nil {
+		return nil, err
+	}
+
+	state := &audioState{
+		sink:   sink.name,
+		volume: sink.percent(),
+		muted:  sink.muted,
+	}
+
+	// a missing source is not an error, there's just nothing to show
+	if source, err := p.deviceInfo(PA_COMMAND_GET_SOURCE_INFO, "@DEFAULT_SOURCE@"); err == nil {
+		state.sourceMuted = source.muted
+	}
+
+	return state, nil
+}
+
+func (p *pulseBackend) changeVolume(delta int, max int) error {
+	sink, err := p.deviceInfo(PA_COMMAND_GET_SINK_INFO, "@DEFAULT_SINK@")
+	if err != nil {
+		return err
+	}
+
+	target := sink.percent() + delta
+	if target > max {
+		target = max
+	} else if target < 0 {
+		target = 0
+	}
+
+	// like pactl, every channel is set to the same volume
+	volume := make([]uint32, len(sink.volume))
+	for idx := range volume {
+		volume[idx] = uint32((target*PULSE_VOLUME_NORM + 50) / 100)
+	}
+
+	return p.do(func(conn *pulseConn) error {
+		args := newPulseCommand(PA_COMMAND_SET_SINK_VOLUME, conn.nextTag())
+		args.putU32(sink.index)
+		args.putString("")
+		args.putCVolume(volume)
+		_, err := conn.request(args)
+		return err
+	})
+}
+
+func (p *pulseBackend) toggleMute() error {
+	return p.toggleDeviceMute(PA_COMMAND_GET_SINK_INFO, PA_COMMAND_SET_SINK_MUTE, "@DEFAULT_SINK@")
+}
+
+func (p *pulseBackend) toggleSourceMute() error {
+	return p.toggleDeviceMute(PA_COMMAND_GET_SOURCE_INFO, PA_COMMAND_SET_SOURCE_MUTE, "@DEFAULT_SOURCE@")
+}
+
+func (p *pulseBackend) cycleSink() error {
+	var sinks []string
+	current, err := p.defaultSink()
+	if err != nil {
+		return err
+	}
+
+	if err := p.do(func(conn *pulseConn) error {
+		reply, err := conn.request(newPulseCommand(PA_COMMAND_GET_SINK_INFO_LIST, conn.nextTag()))
+		if err != nil {
+			return err
+		}
+
+		sinks = make([]string, 0)
+		for !reply.done() {
+			sink := reply.getDeviceInfo()
+			reply.skipSinkInfo(conn.version)
+			if reply.err != nil {
+				return reply.err
+			}
+			sinks = append(sinks, sink.name)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(sinks) < 2 {
+		return nil
+	}
+
+	next := sinks[0]
+	for idx, sink := range sinks {
+		if sink == current {
+			next = sinks[(idx+1)%len(sinks)]
+		}
+	}
+
+	return p.do(func(conn *pulseConn) error {
+		args := newPulseCommand(PA_COMMAND_SET_DEFAULT_SINK, conn.nextTag())
+		args.putString(next)
+		_, err := conn.request(args)
+		return err
+	})
+}
+
+// do runs requests on the shared connection, which is reconnected if it was lost
+func (p *pulseBackend) do(fn func(conn *pulseConn) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn == nil {
+		conn, err := dialPulse(p.socket)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	err := fn(p.conn)
+
+	// errors from the server leave the connection usable
+	var pulseErr *pulseError
+	if err != nil && !errors.As(err, &pulseErr) {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+func (p *pulseBackend) deviceInfo(command uint32, name string) (*pulseDeviceInfo, error) {
+	var info *pulseDeviceInfo
+	err := p.do(func(conn *pulseConn) error {
+		args := newPulseCommand(command, conn.nextTag())
+		args.putU32(PULSE_INVALID_INDEX)
+		args.putString(name)
+
+		reply, err := conn.request(args)
+		if err != nil {
+			return err
+		}
+
+		info = reply.getDeviceInfo()
+		return reply.err
+	})
+	return info, err
+}
+
+func (p *pulseBackend) toggleDeviceMute(getCommand uint32, setCommand uint32, name string) error {
+	device, err := p.deviceInfo(getCommand, name)
+	if err != nil {
+		return err
+	}
+
+	return p.do(func(conn *pulseConn) error {
+		args := newPulseCommand(setCommand, conn.nextTag())
+		args.putU32(device.index)
+		args.putString("")
+		args.putBool(!device.muted)
+		_, err := conn.request(args)
+		return err
+	})
+}
+
+func (p *pulseBackend) defaultSink() (string, error) {
+	var name string
+	err := p.do(func(conn *pulseConn) error {
+		reply, err := conn.request(newPulseCommand(PA_COMMAND_GET_SERVER_INFO, conn.nextTag()))
+		if err != nil {
+			return err
+		}
+
+		// package name and version, user name, host name and sample spec come first
+		reply.skip(5)
+		name = reply.getString()
+		return reply.err
+	})
+	return name, err
+}
+
+// pulseSocketPath returns the socket in PULSE_SERVER if it is a local one,
+// or the default socket in the runtime directory
+func pulseSocketPath() string {
+	for _, server := range strings.Fields(os.Getenv("PULSE_SERVER")) {
+		if strings.HasPrefix(server, "unix:") {
+			return strings.TrimPrefix(server, "unix:")
+		} else if strings.HasPrefix(server, "/") {
+			return server
+		}
+	}
+	return filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "pulse", "native")
+}
+
+// pulseCookie reads the authentication cookie. pipewire-pulse doesn't check
+// it, so a missing cookie is sent as zeros
+func pulseCookie() []byte {
+	paths := []string{os.Getenv("PULSE_COOKIE")}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "pulse", "cookie"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".pulse-cookie"))
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if cookie, err := os.ReadFile(path); err == nil && len(cookie) >= PULSE_COOKIE_LENGTH {
+			return cookie[:PULSE_COOKIE_LENGTH]
+		}
+	}
+	return make([]byte, PULSE_COOKIE_LENGTH)
+}
+
+// pulseError is an error reply from the server
+type pulseError struct {
+	code uint32
+}
+
+func (e *pulseError) Error() string {
+	// the most common ones, from pulse/def.h
+	switch e.code {
+	case 1:
+		return "access denied"
+	case 5:
+		return "no such entity"
+	case 7:
+		return "invalid argument"
+	}
+	return fmt.Sprintf("pulseaudio error %d", e.code)
+}
+
+// pulseConn is an authenticated connection to the server
+type pulseConn struct {
+	net.Conn
+	// the negotiated protocol version
+	version uint32
+	tag     uint32
+}
+
+func dialPulse(socket string) (*pulseConn, error) {
+	conn, err := net.DialTimeout("unix", socket, PULSE_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	c := &pulseConn{Conn: conn}
+
+	// no shared memory is asked for, so the server sends everything over the socket
+	args := newPulseCommand(PA_COMMAND_AUTH, c.nextTag())
+	args.putU32(PULSE_PROTOCOL_VERSION)
+	args.putArbitrary(pulseCookie())
+
+	reply, err := c.request(args)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the upper bits are shared memory flags
+	c.version = reply.getU32() & 0xffff
+	if reply.err != nil {
+		conn.Close()
+		return nil, reply.err
+	}
+	if c.version > PULSE_PROTOCOL_VERSION {
+		c.version = PULSE_PROTOCOL_VERSION
+	} else if c.version < PULSE_MIN_PROTOCOL_VERSION {
+		conn.Close()
+		return nil, fmt.Errorf("unsupported protocol version %d", c.version)
+	}
+
+	args = newPulseCommand(PA_COMMAND_SET_CLIENT_NAME, c.nextTag())
+	args.putProplist(map[string]string{"application.name": "statusbar"})
+	if _, err := c.request(args); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *pulseConn) nextTag() uint32 {
+	c.tag++
+	return c.tag
+}
+
+// request sends a command and returns the arguments of its reply, skipping
+// unrelated packets
+func (c *pulseConn) request(command *pulseTagStruct) (*pulseTagStruct, error) {
+	c.SetDeadline(time.Now().Add(PULSE_TIMEOUT))
+
+	if err := c.writePacket(command.data); err != nil {
+		return nil, err
+	}
+
+	// the tag follows the command
+	tag := binary.BigEndian.Uint32(command.data[6:10])
+
+	for {
+		reply, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		replyCommand := reply.getU32()
+		replyTag := reply.getU32()
+		if reply.err != nil {
+			return nil, reply.err
+		} else if replyTag != tag {
+			continue
+		}
+
+		switch replyCommand {
+		case PA_COMMAND_REPLY:
+			return reply, nil
+		case PA_COMMAND_ERROR:
+			code := reply.getU32()
+			if reply.err != nil {
+				return nil, reply.err
+			}
+			return nil, &pulseError{code: code}
+		}
+	}
+}
+
+// writePacket writes a packet with the descriptor of length, channel, offset and flags
+func (c *pulseConn) writePacket(data []byte) error {
+	packet := make([]byte, 20+len(data))
+	binary.BigEndian.PutUint32(packet[0:], uint32(len(data)))
+	binary.BigEndian.PutUint32(packet[4:], PULSE_CONTROL_CHANNEL)
+	copy(packet[20:], data)
+
+	_, err := c.Write(packet)
+	return err
+}
+
+func (c *pulseConn) readPacket() (*pulseTagStruct, error) {
+	for {
+		descriptor := make([]byte, 20)
+		if _, err := io.ReadFull(c, descriptor); err != nil {
+			return nil, err
+		}
+
+		length := binary.BigEndian.Uint32(descriptor[0:])
+		if length > 1<<24 {
+			return nil, fmt.Errorf("packet too large: %d bytes", length)
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c, data); err != nil {
+			return nil, err
+		}
+
+		// memblocks belong to streams, which are never created
+		if binary.BigEndian.Uint32(descriptor[4:]) == PULSE_CONTROL_CHANNEL {
+			return &pulseTagStruct{data: data}, nil
+		}
+	}
+}
+
+// pulseDeviceInfo is the start of a sink or source info, up to the mute flag
+type pulseDeviceInfo struct {
+	index  uint32
+	name   string
+	volume []uint32
+	muted  bool
+}
+
+// percent returns the average of the channel volumes
+func (d *pulseDeviceInfo) percent() int {
+	if len(d.volume) == 0 {
+		return 0
+	}
+
+	var sum uint64
+	for _, volume := range d.volume {
+		sum += uint64(volume)
+	}
+	average := sum / uint64(len(d.volume))
+	return int((average*100 + PULSE_VOLUME_NORM/2) / PULSE_VOLUME_NORM)
+}
+
+// pulseTagStruct is the serialization of the native protocol, where every
+// value is prefixed by a type tag. reads past an error do nothing, so only
+// the last one needs checking
+type pulseTagStruct struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// type tags, from pulsecore/tagstruct.h
+const (
+	pulseTagString       = 't'
+	pulseTagStringNull   = 'N'
+	pulseTagU32          = 'L'
+	pulseTagU8           = 'B'
+	pulseTagU64          = 'R'
+	pulseTagS64          = 'r'
+	pulseTagSampleSpec   = 'a'
+	pulseTagArbitrary    = 'x'
+	pulseTagBooleanTrue  = '1'
+	pulseTagBooleanFalse = '0'
+	pulseTagTimeval      = 'T'
+	pulseTagUsec         = 'U'
+	pulseTagChannelMap   = 'm'
+	pulseTagCVolume      = 'v'
+	pulseTagProplist     = 'P'
+	pulseTagVolume       = 'V'
+	pulseTagFormatInfo   = 'f'
+)
+
+func newPulseCommand(command uint32, tag uint32) *pulseTagStruct {
+	t := &pulseTagStruct{}
+	t.putU32(command)
+	t.putU32(tag)
+	return t
+}
+
+func (t *pulseTagStruct) putU32(value uint32) {
+	t.data = append(t.data, pulseTagU32)
+	t.data = binary.BigEndian.AppendUint32(t.data, value)
+}
+
+func (t *pulseTagStruct) putBool(value bool) {
+	if value {
+		t.data = append(t.data, pulseTagBooleanTrue)
+	} else {
+		t.data = append(t.data, pulseTagBooleanFalse)
+	}
+}
+
+// putString puts a string, or null if it is empty
+func (t *pulseTagStruct) putString(value string) {
+	if value == "" {
+		t.data = append(t.data, pulseTagStringNull)
+		return
+	}
+	t.data = append(t.data, pulseTagString)
+	t.data = append(t.data, value...)
+	t.data = append(t.data, 0)
+}
+
+func (t *pulseTagStruct) putArbitrary(value []byte) {
+	t.data = append(t.data, pulseTagArbitrary)
+	t.data = binary.BigEndian.AppendUint32(t.data, uint32(len(value)))
+	t.data = append(t.data, value...)
+}
+
+func (t *pulseTagStruct) putCVolume(volume []uint32) {
+	t.data = append(t.data, pulseTagCVolume, byte(len(volume)))
+	for _, value := range volume {
+		t.data = binary.BigEndian.AppendUint32(t.data, value)
+	}
+}
+
+// putProplist puts string properties, which include their terminating null
+func (t *pulseTagStruct) putProplist(props map[string]string) {
+	t.data = append(t.data, pulseTagProplist)
+	for key, value := range props {
+		t.putString(key)
+		t.putU32(uint32(len(value) + 1))
+		t.putArbitrary(append([]byte(value), 0))
+	}
+	t.putString("")
+}
+
+func (t *pulseTagStruct) done() bool {
+	return t.err != nil || t.pos >= len(t.data)
+}
+
+// read returns the next n bytes
+func (t *pulseTagStruct) read(n int) []byte {
+	if t.err != nil {
+		return nil
+	}
+	if n < 0 || t.pos+n > len(t.data) {
+		t.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	data := t.data[t.pos : t.pos+n]
+	t.pos += n
+	return data
+}
+
+// readTag reads a type tag, which must be one of the expected ones
+func (t *pulseTagStruct) readTag(expected ...byte) byte {
+	data := t.read(1)
+	if data == nil {
+		return 0
+	}
+
+	for _, tag := range expected {
+		if data[0] == tag {
+			return tag
+		}
+	}
+	t.err = fmt.Errorf("unexpected tag %q", data[0])
+	return 0
+}
+
+func (t *pulseTagStruct) readU32() uint32 {
+	if data := t.read(4); data != nil {
+		return binary.BigEndian.Uint32(data)
+	}
+	return 0
+}
+
+func (t *pulseTagStruct) readU8() uint8 {
+	if data := t.read(1); data != nil {
+		return data[0]
+	}
+	return 0
+}
+
+func (t *pulseTagStruct) getU32() uint32 {
+	t.readTag(pulseTagU32)
+	return t.readU32()
+}
+
+func (t *pulseTagStruct) getU8() uint8 {
+	t.readTag(pulseTagU8)
+	return t.readU8()
+}
+
+func (t *pulseTagStruct) getBool() bool {
+	return t.readTag(pulseTagBooleanTrue, pulseTagBooleanFalse) == pulseTagBooleanTrue
+}
+
+// getString reads a string, null is returned as an empty string
+func (t *pulseTagStruct) getString() string {
+	if t.readTag(pulseTagString, pulseTagStringNull) != pulseTagString {
+		return ""
+	}
+	return t.readCString()
+}
+
+// readCString reads a null terminated string
+func (t *pulseTagStruct) readCString() string {
+	if t.err != nil {
+		return ""
+	}
+
+	for end := t.pos; end < len(t.data); end++ {
+		if t.data[end] == 0 {
+			value := string(t.data[t.pos:end])
+			t.pos = end + 1
+			return value
+		}
+	}
+	t.err = io.ErrUnexpectedEOF
+	return ""
+}
+
+func (t *pulseTagStruct) getCVolume() []uint32 {
+	t.readTag(pulseTagCVolume)
+	volume := make([]uint32, t.readU8())
+	for idx := range volume {
+		volume[idx] = t.readU32()
+	}
+	return volume
+}
+
+// getDeviceInfo reads the fields sinks and sources start with: index, name,
+// description, sample spec, channel map, owner module, volume and mute
+func (t *pulseTagStruct) getDeviceInfo() *pulseDeviceInfo {
+	info := &pulseDeviceInfo{}
+	info.index = t.getU32()
+	info.name = t.getString()
+	t.skip(4)
+	info.volume = t.getCVolume()
+	info.muted = t.getBool()
+	return info
+}
+
+// skipSinkInfo skips the rest of a sink after getDeviceInfo, which depends on
+// the protocol version
+func (t *pulseTagStruct) skipSinkInfo(version uint32) {
+	// monitor source index and name, latency, driver and flags
+	t.skip(5)
+	if version >= 13 {
+		// proplist and configured latency
+		t.skip(2)
+	}
+	if version >= 15 {
+		// base volume, state, volume steps and card
+		t.skip(4)
+	}
+	if version >= 16 {
+		// name, description, priority and availability of each port,
+		// followed by the active port
+		ports := int(t.getU32())
+		perPort := 3
+		if version >= 24 {
+			perPort++
+		}
+		t.skip(ports*perPort + 1)
+	}
+	if version >= 21 {
+		t.skip(int(t.getU8()))
+	}
+}
+
+// skip skips n values of any type
+func (t *pulseTagStruct) skip(n int) {
+	for i := 0; i < n && t.err == nil; i++ {
+		switch t.readTag(pulseTagString, pulseTagStringNull, pulseTagU32, pulseTagU8, pulseTagU64,
+			pulseTagS64, pulseTagSampleSpec, pulseTagArbitrary, pulseTagBooleanTrue, pulseTagBooleanFalse,
+			pulseTagTimeval, pulseTagUsec, pulseTagChannelMap, pulseTagCVolume, pulseTagProplist,
+			pulseTagVolume, pulseTagFormatInfo) {
+		case pulseTagString:
+			t.readCString()
+		case pulseTagU8:
+			t.read(1)
+		case pulseTagU32, pulseTagVolume:
+			t.read(4)
+		case pulseTagSampleSpec:
+			// format, channels and rate
+			t.read(6)
+		case pulseTagU64, pulseTagS64, pulseTagUsec, pulseTagTimeval:
+			t.read(8)
+		case pulseTagArbitrary:
+			t.read(int(t.readU32()))
+		case pulseTagChannelMap:
+			t.read(int(t.readU8()))
+		case pulseTagCVolume:
+			t.read(4 * int(t.readU8()))
+		case pulseTagProplist:
+			// key, length and value until a null key
+			for t.err == nil {
+				if t.getString() == "" {
+					break
+				}
+				t.skip(2)
+			}
+		case pulseTagFormatInfo:
+			// encoding and proplist
+			t.skip(2)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package widget
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakePulseServer answers the commands used by pulseBackend, as a server
+// speaking a newer protocol version would
+type fakePulseServer struct {
+	sync.Mutex
+	listener net.Listener
+
+	defaultSink string
+	sinks       []*pulseDeviceInfo
+	sourceMuted bool
+}
+
+func newFakePulseServer(t *testing.T) *fakePulseServer {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "native"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakePulseServer{
+		listener:    listener,
+		defaultSink: "speakers",
+		sinks: []*pulseDeviceInfo{
+			{index: 1, name: "speakers", volume: []uint32{PULSE_VOLUME_NORM / 2, PULSE_VOLUME_NORM / 2}},
+			{index: 2, name: "headphones", volume: []uint32{PULSE_VOLUME_NORM}, muted: true},
+		},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(&pulseConn{Conn: conn})
+		}
+	}()
+	return server
+}
+
+func (s *fakePulseServer) serve(conn *pulseConn) {
+	defer conn.Close()
+
+	for {
+		packet, err := conn.readPacket()
+		if err != nil {
+			return
+		}
+		command := packet.getU32()
+		tag := packet.getU32()
+
+		s.Lock()
+		reply := newPulseCommand(PA_COMMAND_REPLY, tag)
+		switch command {
+		case PA_COMMAND_AUTH:
+			reply.putU32(35)
+		case PA_COMMAND_SET_CLIENT_NAME:
+			reply.putU32(7)
+		case PA_COMMAND_GET_SERVER_INFO:
+			for _, value := range []string{"pulseaudio", "17.0", "user", "host"} {
+				reply.putString(value)
+			}
+			reply.data = append(reply.data, pulseTagSampleSpec, 3, 2, 0, 0, 0xbb, 0x80)
+			reply.putString(s.defaultSink)
+			reply.putString("microphone")
+		case PA_COMMAND_GET_SINK_INFO:
+			packet.getU32()
+			if sink := s.sink(packet.getString()); sink != nil {
+				putFakeSink(reply, sink)
+			} else {
+				reply = newPulseCommand(PA_COMMAND_ERROR, tag)
+				reply.putU32(5)
+			}
+		case PA_COMMAND_GET_SINK_INFO_LIST:
+			for _, sink := range s.sinks {
+				putFakeSink(reply, sink)
+			}
+		case PA_COMMAND_GET_SOURCE_INFO:
+			putFakeSink(reply, &pulseDeviceInfo{index: 3, name: "microphone", volume: []uint32{PULSE_VOLUME_NORM}, muted: s.sourceMuted})
+		case PA_COMMAND_SET_SINK_VOLUME:
+			sink := s.sinkByIndex(packet.getU32())
+			packet.getString()
+			sink.volume = packet.getCVolume()
+		case PA_COMMAND_SET_SINK_MUTE:
+			sink := s.sinkByIndex(packet.getU32())
+			packet.getString()
+			sink.muted = packet.getBool()
+		case PA_COMMAND_SET_SOURCE_MUTE:
+			packet.getU32()
+			packet.getString()
+			s.sourceMuted = packet.getBool()
+		case PA_COMMAND_SET_DEFAULT_SINK:
+			s.defaultSink = packet.getString()
+		}
+		s.Unlock()
+
+		if err := conn.writePacket(reply.data); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakePulseServer) sink(name string) *pulseDeviceInfo {
+	if name == "@DEFAULT_SINK@" {
+		name = s.defaultSink
+	}
+	for _, sink := range s.sinks {
+		if sink.name == name {
+			return sink
+		}
+	}
+	return nil
+}
+
+func (s *fakePulseServer) sinkByIndex(index uint32) *pulseDeviceInfo {
+	for _, sink := range s.sinks {
+		if sink.index == index {
+			return sink
+		}
+	}
+	return &pulseDeviceInfo{}
+}
+
+// putFakeSink puts a sink info as sent in protocol version 32, with a port and a format
+func putFakeSink(t *pulseTagStruct, sink *pulseDeviceInfo) {
+	t.putU32(sink.index)
+	t.putString(sink.name)
+	t.putString("Description of " + sink.name)
+	t.data = append(t.data, pulseTagSampleSpec, 3, byte(len(sink.volume)), 0, 0, 0xbb, 0x80)
+	t.data = append(t.data, pulseTagChannelMap, byte(len(sink.volume)))
+	for range sink.volume {
+		t.data = append(t.data, 1)
+	}
+	t.putU32(PULSE_INVALID_INDEX)
+	t.putCVolume(sink.volume)
+	t.putBool(sink.muted)
+
+	// monitor source, latency, driver and flags
+	t.putU32(10)
+	t.putString(sink.name + ".monitor")
+	t.data = append(t.data, pulseTagUsec, 0, 0, 0, 0, 0, 0, 0x10, 0)
+	t.putString("module-alsa-card.c")
+	t.putU32(0x3f)
+	// proplist and configured latency
+	t.putProplist(map[string]string{"device.class": "sound", "device.api": "alsa"})
+	t.data = append(t.data, pulseTagUsec, 0, 0, 0, 0, 0, 0, 0, 0)
+	// base volume, state, volume steps and card
+	t.data = append(t.data, pulseTagVolume)
+	t.data = binary.BigEndian.AppendUint32(t.data, PULSE_VOLUME_NORM)
+	t.putU32(0)
+	t.putU32(PULSE_VOLUME_NORM + 1)
+	t.putU32(0)
+	// a port, and the active port
+	t.putU32(1)
+	t.putString("analog-output")
+	t.putString("Analog Output")
+	t.putU32(9900)
+	t.putU32(2)
+	t.putString("analog-output")
+	// a format
+	t.data = append(t.data, pulseTagU8, 1)
+	t.data = append(t.data, pulseTagFormatInfo, pulseTagU8, 1)
+	t.putProplist(map[string]string{})
+}
+
+func newTestPulseBackend(t *testing.T, server *fakePulseServer) *pulseBackend {
+	backend := &pulseBackend{socket: server.listener.Addr().String()}
+	if err := backend.setup(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(backend.close)
+
+	if backend.conn.version != PULSE_PROTOCOL_VERSION {
+		t.Errorf("negotiated version %d, want %d", backend.conn.version, PULSE_PROTOCOL_VERSION)
+	}
+	return backend
+}
+
+func TestPulseState(t *testing.T) {
+	server := newFakePulseServer(t)
+	backend := newTestPulseBackend(t, server)
+
+	state, err := backend.state()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.sink != "speakers" || state.volume != 50 || state.muted || state.sourceMuted {
+		t.Errorf("got %+v", state)
+	}
+
+	if err := backend.toggleMute(); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.toggleSourceMute(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = backend.state()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.muted || !state.sourceMuted {
+		t.Errorf("got %+v, want sink and source muted", state)
+	}
+}
+
+func TestPulseChangeVolume(t *testing.T) {
+	server := newFakePulseServer(t)
+	backend := newTestPulseBackend(t, server)
+
+	if err := backend.changeVolume(5, 100); err != nil {
+		t.Fatal(err)
+	}
+	if volume := server.sinks[0].volume; len(volume) != 2 || volume[0] != 36045 || volume[1] != 36045 {
+		t.Errorf("got %v, want both channels at 55%%", volume)
+	}
+
+	if err := backend.changeVolume(80, 100); err != nil {
+		t.Fatal(err)
+	}
+	if volume := server.sinks[0].volume; volume[0] != PULSE_VOLUME_NORM {
+		t.Errorf("got %v, want the max volume", volume)
+	}
+}
+
+func TestPulseCycleSink(t *testing.T) {
+	server := newFakePulseServer(t)
+	backend := newTestPulseBackend(t, server)
+
+	for _, want := range []string{"headphones", "speakers"} {
+		if err := backend.cycleSink(); err != nil {
+			t.Fatal(err)
+		}
+		if server.defaultSink != want {
+			t.Errorf("default sink %s, want %s", server.defaultSink, want)
+		}
+	}
+}
+
+func TestPulseErrorKeepsConnection(t *testing.T) {
+	server := newFakePulseServer(t)
+	backend := newTestPulseBackend(t, server)
+
+	server.defaultSink = "missing"
+	if _, err := backend.state(); err == nil || err.Error() != "no such entity" {
+		t.Errorf("got %v, want no such entity", err)
+	}
+	if backend.conn == nil {
+		t.Error("connection was closed after an error reply")
+	}
+}
+
+func TestPulseTagStructSkip(t *testing.T) {
+	reply := &pulseTagStruct{}
+	putFakeSink(reply, &pulseDeviceInfo{index: 4, name: "first", volume: []uint32{1}})
+	putFakeSink(reply, &pulseDeviceInfo{index: 5, name: "second", volume: []uint32{2, 3}})
+
+	names := make([]string, 0)
+	for !reply.done() {
+		sink := reply.getDeviceInfo()
+		reply.skipSinkInfo(PULSE_PROTOCOL_VERSION)
+		names = append(names, sink.name)
+	}
+
+	if reply.err != nil {
+		t.Fatal(reply.err)
+	}
+	if len(names) != 2 || names[1] != "second" {
+		t.Errorf("got %v", names)
+	}
+}
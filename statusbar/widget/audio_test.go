@@ -0,0 +1,107 @@
+package widget
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeAudioBackend records the calls made by the widget
+type fakeAudioBackend struct {
+	audioState
+	calls []string
+}
+
+func (f *fakeAudioBackend) setup() error {
+	return nil
+}
+
+func (f *fakeAudioBackend) close() {}
+
+func (f *fakeAudioBackend) subscribe(changed chan<- struct{}) error {
+	return nil
+}
+
+func (f *fakeAudioBackend) state() (*audioState, error) {
+	state := f.audioState
+	return &state, nil
+}
+
+func (f *fakeAudioBackend) changeVolume(delta int, max int) error {
+	f.calls = append(f.calls, fmt.Sprintf("volume %d %d", delta, max))
+	return nil
+}
+
+func (f *fakeAudioBackend) toggleMute() error {
+	f.calls = append(f.calls, "mute")
+	return nil
+}
+
+func (f *fakeAudioBackend) toggleSourceMute() error {
+	f.calls = append(f.calls, "source mute")
+	return nil
+}
+
+func (f *fakeAudioBackend) cycleSink() error {
+	f.calls = append(f.calls, "cycle")
+	return nil
+}
+
+func newTestAudio(config AudioConfig, backend audioBackend) *Audio {
+	return newAudioWidget(config, backend).impl.(*Audio)
+}
+
+func TestAudioUpdate(t *testing.T) {
+	tests := []struct {
+		state audioState
+		want  string
+	}{
+		{audioState{volume: 80}, fmt.Sprintf("%c 80%%", ICON_VOLUME_HIGH)},
+		{audioState{volume: 50}, fmt.Sprintf("%c 50%%", ICON_VOLUME_MEDIUM)},
+		{audioState{volume: 10}, fmt.Sprintf("%c 10%%", ICON_VOLUME_LOW)},
+		{audioState{volume: 0}, fmt.Sprintf("%c 0%%", ICON_VOLUME_OFF)},
+		{audioState{volume: 80, muted: true}, fmt.Sprintf("%c 80%%", ICON_VOLUME_OFF)},
+		{audioState{volume: 80, sourceMuted: true}, fmt.Sprintf("%c %c 80%%", ICON_MICROPHONE_OFF, ICON_VOLUME_HIGH)},
+	}
+
+	for _, test := range tests {
+		audio := newTestAudio(AudioConfig{}, &fakeAudioBackend{audioState: test.state})
+
+		block := &block{}
+		audio.update(block)
+		if block.FullText != test.want {
+			t.Errorf("%+v: got %q, want %q", test.state, block.FullText, test.want)
+		}
+	}
+}
+
+func TestAudioOnClick(t *testing.T) {
+	backend := &fakeAudioBackend{}
+	audio := newTestAudio(AudioConfig{Step: 2, MaxVolume: 150}, backend)
+
+	for btn := 1; btn <= 5; btn++ {
+		audio.onClick(0, 0, btn)
+	}
+
+	want := "mute, source mute, cycle, volume 2 150, volume -2 150"
+	if got := strings.Join(backend.calls, ", "); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAudioDefaults(t *testing.T) {
+	backend := &fakeAudioBackend{}
+	audio := newTestAudio(AudioConfig{}, backend)
+
+	audio.onClick(0, 0, 4)
+	if len(backend.calls) != 1 || backend.calls[0] != "volume 5 100" {
+		t.Errorf("got %v, want the default step and max volume", backend.calls)
+	}
+}
+
+func TestParsePactlVolume(t *testing.T) {
+	out := "Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: 39322 /  60% / -13.31 dB"
+	if volume := parsePactlVolume(out); volume != 55 {
+		t.Errorf("got %d, want 55", volume)
+	}
+}
@@ -0,0 +1,201 @@
+package widget
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+// nf-md-brightness
+const ICON_BRIGHTNESS_HIGH = '󰃠'
+const ICON_BRIGHTNESS_MEDIUM = '󰃟'
+const ICON_BRIGHTNESS_LOW = '󰃞'
+
+type BacklightConfig struct {
+	// SysfsRoot is the mount point of sysfs, defaults to /sys
+	SysfsRoot string
+	// Device is the name of the device in /sys/class/backlight, defaults to the first one
+	Device string
+	// Step is the brightness change in percent per scroll step, defaults to 5
+	Step int
+}
+
+type Backlight struct {
+	*Widget
+	config BacklightConfig
+
+	// path to the device directory in sysfs
+	device  string
+	dbus    *dbus.Conn
+	changed chan struct{}
+}
+
+func NewBacklightWidget(config BacklightConfig) *Widget {
+	if config.SysfsRoot == "" {
+		config.SysfsRoot = "/sys"
+	}
+	if config.Step == 0 {
+		config.Step = 5
+	}
+
+	return newWidget("backlight", -1, func(widget *Widget) impl {
+		return &Backlight{
+			Widget:  widget,
+			config:  config,
+			changed: make(chan struct{}, 1),
+		}
+	})
+}
+
+func (b *Backlight) setup() {
+	if b.config.Device != "" {
+		b.device = filepath.Join(b.config.SysfsRoot, "class/backlight", b.config.Device)
+	} else if devices, _ := filepath.Glob(filepath.Join(b.config.SysfsRoot, "class/backlight/*")); len(devices) > 0 {
+		b.device = devices[0]
+	} else {
+		log.Printf("no backlight device found")
+		return
+	}
+
+	// logind lets the session owner set the brightness without root
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		log.Printf("failed to connect to dbus: %s", err.Error())
+		return
+	}
+	b.dbus = conn
+}
+
+func (b *Backlight) close() {
+	if b.dbus != nil {
+		b.dbus.Close()
+	}
+}
+
+func (b *Backlight) run() {
+	if b.device == "" {
+		return
+	}
+
+	go func() {
+		// the kernel only notifies about actual_brightness when the firmware or
+		// a hotkey changes the brightness, and some drivers never update brightness
+		files := []string{filepath.Join(b.device, "brightness")}
+		if _, err := os.Stat(filepath.Join(b.device, "actual_brightness")); err == nil {
+			files = append(files, filepath.Join(b.device, "actual_brightness"))
+		}
+
+		for {
+			if err := util.WatchFiles(files, b.changed); err != nil {
+				log.Printf("failed to watch brightness: %s", err.Error())
+			}
+			time.Sleep(30 * time.Second)
+		}
+	}()
+
+	b.sendUpdate()
+	for range b.changed {
+		b.sendUpdate()
+	}
+}
+
+func (b *Backlight) update(block *block) {
+	percent, err := b.readBrightness()
+	if err != nil {
+		log.Printf("failed to read brightness: %s", err.Error())
+		block.FullText = ""
+		return
+	}
+
+	icon := ICON_BRIGHTNESS_HIGH
+	if percent < 33 {
+		icon = ICON_BRIGHTNESS_LOW
+	} else if percent < 66 {
+		icon = ICON_BRIGHTNESS_MEDIUM
+	}
+
+	block.FullText = fmt.Sprintf("%c %d%%", icon, percent)
+}
+
+// scrolling changes the brightness
+func (b *Backlight) onClick(x int, y int, btn int) {
+	if btn == 4 {
+		b.changeBrightness(b.config.Step)
+	} else if btn == 5 {
+		b.changeBrightness(-b.config.Step)
+	}
+}
+
+// readBrightness returns the current brightness in percent
+func (b *Backlight) readBrightness() (int, error) {
+	brightness, max, err := b.readRawBrightness()
+	if err != nil {
+		return 0, err
+	}
+	return int((brightness*100 + max/2) / max), nil
+}
+
+func (b *Backlight) readRawBrightness() (int64, int64, error) {
+	if b.device == "" {
+		return 0, 0, fmt.Errorf("no backlight device")
+	}
+
+	// actual_brightness is what the hardware is set to, which is also
+	// changed by the firmware
+	brightness, err := util.ReadFileInt(filepath.Join(b.device, "actual_brightness"))
+	if err != nil {
+		if brightness, err = util.ReadFileInt(filepath.Join(b.device, "brightness")); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	max, err := util.ReadFileInt(filepath.Join(b.device, "max_brightness"))
+	if err != nil {
+		return 0, 0, err
+	} else if max <= 0 {
+		return 0, 0, fmt.Errorf("invalid max_brightness %d", max)
+	}
+
+	return brightness, max, nil
+}
+
+// changeBrightness changes the brightness by delta percent through systemd-logind
+func (b *Backlight) changeBrightness(delta int) {
+	if b.dbus == nil {
+		return
+	}
+
+	brightness, max, err := b.readRawBrightness()
+	if err != nil {
+		log.Printf("failed to read brightness: %s", err.Error())
+		return
+	}
+
+	// devices with few levels, such as 7 or 15, still change by one per step
+	step := max * int64(delta) / 100
+	if step == 0 && delta > 0 {
+		step = 1
+	} else if step == 0 && delta < 0 {
+		step = -1
+	}
+
+	target := brightness + step
+	if target > max {
+		target = max
+	} else if target < 1 {
+		// don't turn the screen off completely
+		target = 1
+	}
+
+	session := b.dbus.Object("org.freedesktop.login1", "/org/freedesktop/login1/session/auto")
+	call := session.Call("org.freedesktop.login1.Session.SetBrightness", 0,
+		"backlight", filepath.Base(b.device), uint32(target))
+	if call.Err != nil {
+		log.Printf("failed to set brightness: %s", call.Err.Error())
+	}
+}
@@ -0,0 +1,128 @@
+package widget
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeLogindSession records the brightness set through it
+type fakeLogindSession struct {
+	sync.Mutex
+	calls []string
+}
+
+func (f *fakeLogindSession) SetBrightness(subsystem string, name string, brightness uint32) *dbus.Error {
+	f.Lock()
+	defer f.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf("%s %s %d", subsystem, name, brightness))
+	return nil
+}
+
+func (f *fakeLogindSession) lastCall() string {
+	f.Lock()
+	defer f.Unlock()
+
+	if len(f.calls) == 0 {
+		return ""
+	}
+	return f.calls[len(f.calls)-1]
+}
+
+// newTestBacklight returns a backlight widget connected to a fake logind
+func newTestBacklight(t *testing.T, config BacklightConfig) (*Backlight, *fakeLogindSession) {
+	t.Helper()
+
+	address := startPrivateBus(t)
+	conn := connectPrivateBus(t, address)
+	session := &fakeLogindSession{}
+	if err := conn.Export(session, "/org/freedesktop/login1/session/auto", "org.freedesktop.login1.Session"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName("org.freedesktop.login1", dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own the logind name: %v", err)
+	}
+
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	backlight := NewBacklightWidget(config).impl.(*Backlight)
+	backlight.setup()
+	if backlight.dbus == nil {
+		t.Fatal("not connected to logind")
+	}
+	t.Cleanup(backlight.close)
+	return backlight, session
+}
+
+func TestBacklightDevice(t *testing.T) {
+	// only reading, without logind
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "none"))
+
+	root := t.TempDir()
+	writeSysfs(t, root, "class/backlight/acpi_video0", map[string]string{"brightness": "5", "max_brightness": "10"})
+	writeSysfs(t, root, "class/backlight/intel_backlight", map[string]string{
+		"brightness":        "480",
+		"actual_brightness": "240",
+		"max_brightness":    "960",
+	})
+
+	backlight := NewBacklightWidget(BacklightConfig{SysfsRoot: root}).impl.(*Backlight)
+	backlight.setup()
+	if want := filepath.Join(root, "class/backlight/acpi_video0"); backlight.device != want {
+		t.Errorf("device %s, want the first one %s", backlight.device, want)
+	}
+
+	backlight = NewBacklightWidget(BacklightConfig{SysfsRoot: root, Device: "intel_backlight"}).impl.(*Backlight)
+	backlight.setup()
+
+	// actual_brightness takes precedence
+	block := &block{}
+	backlight.update(block)
+	if want := fmt.Sprintf("%c 25%%", ICON_BRIGHTNESS_LOW); block.FullText != want {
+		t.Errorf("got %q, want %q", block.FullText, want)
+	}
+
+	backlight = NewBacklightWidget(BacklightConfig{SysfsRoot: t.TempDir()}).impl.(*Backlight)
+	backlight.setup()
+	if _, err := backlight.readBrightness(); err == nil {
+		t.Error("expected an error without a backlight device")
+	}
+}
+
+func TestBacklightScroll(t *testing.T) {
+	tests := []struct {
+		brightness string
+		max        string
+		btn        int
+		want       string
+	}{
+		// 5% of 960
+		{"480", "960", 4, "backlight intel_backlight 528"},
+		{"480", "960", 5, "backlight intel_backlight 432"},
+		// devices with few levels change by one
+		{"3", "7", 4, "backlight intel_backlight 4"},
+		{"3", "7", 5, "backlight intel_backlight 2"},
+		// clamped to the range, without turning the screen off
+		{"950", "960", 4, "backlight intel_backlight 960"},
+		{"7", "7", 4, "backlight intel_backlight 7"},
+		{"1", "7", 5, "backlight intel_backlight 1"},
+	}
+
+	root := t.TempDir()
+	writeSysfs(t, root, "class/backlight/intel_backlight", map[string]string{"brightness": "0", "max_brightness": "1"})
+	backlight, session := newTestBacklight(t, BacklightConfig{SysfsRoot: root})
+
+	for _, test := range tests {
+		writeSysfs(t, root, "class/backlight/intel_backlight", map[string]string{
+			"brightness":     test.brightness,
+			"max_brightness": test.max,
+		})
+
+		backlight.onClick(0, 0, test.btn)
+		if got := session.lastCall(); got != test.want {
+			t.Errorf("%s/%s button %d: got %q, want %q", test.brightness, test.max, test.btn, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package widget
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+// nf-md-battery, from empty to full in steps of 10%
+var ICON_BATTERY = []rune{'󰂎', '󰁺', '󰁻', '󰁼', '󰁽', '󰁾', '󰁿', '󰂀', '󰂁', '󰂂', '󰁹'}
+
+// nf-md-battery_charging
+const ICON_BATTERY_CHARGING = '󰂄'
+
+// nf-md-power_plug
+const ICON_BATTERY_PLUGGED = '󰚥'
+
+const UPOWER_DISPLAY_DEVICE = "/org/freedesktop/UPower/devices/DisplayDevice"
+
+type BatteryConfig struct {
+	// SysfsRoot is the mount point of sysfs, defaults to /sys
+	SysfsRoot string
+
+	// percentages at or below which the widget is colored and set urgent
+	WarningThreshold int
+	UrgentThreshold  int
+
+	// UPower enables event-driven updates from UPower over the system bus.
+	// sysfs is polled less often when it is available
+	UPower bool
+}
+
+type batteryStatus int
+
+const (
+	batteryUnknown batteryStatus = iota
+	batteryDischarging
+	batteryCharging
+	batteryNotCharging
+	batteryFull
+)
+
+// batteryData is the combined state of all batteries
+type batteryData struct {
+	percent float64
+	status  batteryStatus
+	// time to empty when discharging, time to full when charging
+	remaining time.Duration
+}
+
+type Battery struct {
+	*Widget
+	config BatteryConfig
+
+	dbus            *dbus.Conn
+	upSignalChannel chan *dbus.Signal
+}
+
+func NewBatteryWidget(config BatteryConfig) *Widget {
+	if config.SysfsRoot == "" {
+		config.SysfsRoot = "/sys"
+	}
+	if config.WarningThreshold == 0 {
+		config.WarningThreshold = 20
+	}
+	if config.UrgentThreshold == 0 {
+		config.UrgentThreshold = 10
+	}
+
+	return newWidget("battery", 10000, func(widget *Widget) impl {
+		return &Battery{
+			Widget:          widget,
+			config:          config,
+			upSignalChannel: make(chan *dbus.Signal, 10),
+		}
+	})
+}
+
+func (b *Battery) setup() {
+	// desktops have no battery, the block stays empty instead of polling
+	if _, err := readBatteryData(b.config.SysfsRoot); err != nil {
+		log.Printf("hiding battery widget: %s", err.Error())
+		b.Interval = 0
+		return
+	}
+
+	if !b.config.UPower {
+		return
+	}
+
+	// fall back to only polling sysfs if upower is unavailable
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		log.Printf("failed to connect to dbus: %s", err.Error())
+		return
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(UPOWER_DISPLAY_DEVICE),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		log.Printf("failed to subscribe to upower: %s", err.Error())
+		conn.Close()
+		return
+	}
+
+	conn.Signal(b.upSignalChannel)
+	b.dbus = conn
+
+	// time estimates still need to be refreshed now and then
+	b.Interval = 60000
+}
+
+func (b *Battery) close() {
+	if b.dbus != nil {
+		b.dbus.Close()
+	}
+}
+
+func (b *Battery) run() {
+	if b.dbus == nil {
+		return
+	}
+
+	for range b.upSignalChannel {
+		b.sendUpdate()
+	}
+}
+
+func (b *Battery) update(block *block) {
+	data, err := readBatteryData(b.config.SysfsRoot)
+	if err != nil {
+		log.Printf("failed to read battery data: %s", err.Error())
+		block.FullText = ""
+		return
+	}
+
+	icon := ICON_BATTERY[int(data.percent+5)/10]
+	if data.status == batteryCharging {
+		icon = ICON_BATTERY_CHARGING
+	} else if data.status == batteryFull || data.status == batteryNotCharging {
+		icon = ICON_BATTERY_PLUGGED
+	}
+
+	block.FullText = fmt.Sprintf("%c %.0f%%", icon, data.percent)
+	if data.remaining > 0 {
+		block.FullText += fmt.Sprintf(" %d:%02d", int(data.remaining.Hours()), int(data.remaining.Minutes())%60)
+	}
+
+	discharging := data.status == batteryDischarging
+	block.Urgent = discharging && data.percent <= float64(b.config.UrgentThreshold)
+	if discharging && data.percent <= float64(b.config.WarningThreshold) {
+		block.Color = COLOR_WARNING
+	} else if data.status == batteryCharging {
+		block.Color = COLOR_GOOD
+	} else {
+		block.Color = ""
+	}
+}
+
+func (b *Battery) onClick(x int, y int, btn int) {}
+
+// readBatteryData reads and combines all batteries under <root>/class/power_supply
+func readBatteryData(root string) (*batteryData, error) {
+	supplies, err := filepath.Glob(filepath.Join(root, "class/power_supply/*"))
+	if err != nil {
+		return nil, err
+	}
+
+	// totals in µWh and µW, and in µAh and µA for batteries whose charge
+	// can't be converted to energy
+	var energy, charge batteryTotals
+	var capacity float64
+	batteries := 0
+	result := &batteryData{status: batteryUnknown}
+
+	for _, supply := range supplies {
+		if kind, _ := util.ReadFileString(filepath.Join(supply, "type")); kind != "Battery" {
+			continue
+		}
+		if present, err := util.ReadFileInt(filepath.Join(supply, "present")); err == nil && present == 0 {
+			continue
+		}
+
+		batteries++
+
+		// charging or discharging takes precedence over idle batteries
+		status := parseBatteryStatus(supply)
+		if result.status == batteryUnknown || status == batteryCharging || status == batteryDischarging {
+			result.status = status
+		}
+
+		if c, err := util.ReadFileInt(filepath.Join(supply, "capacity")); err == nil {
+			capacity += float64(c)
+		}
+
+		// batteries report either energy (µWh, µW) or charge (µAh, µA)
+		totals := &energy
+		now, errNow := util.ReadFileInt(filepath.Join(supply, "energy_now"))
+		full, errFull := util.ReadFileInt(filepath.Join(supply, "energy_full"))
+		rate, errRate := util.ReadFileInt(filepath.Join(supply, "power_now"))
+		if errNow != nil || errFull != nil {
+			now, errNow = util.ReadFileInt(filepath.Join(supply, "charge_now"))
+			full, errFull = util.ReadFileInt(filepath.Join(supply, "charge_full"))
+			rate, errRate = util.ReadFileInt(filepath.Join(supply, "current_now"))
+
+			// µAh times µV is µWh when divided by a million
+			if voltage := batteryVoltage(supply); voltage > 0 {
+				now = now * voltage / 1e6
+				full = full * voltage / 1e6
+				rate = rate * voltage / 1e6
+			} else {
+				totals = &charge
+			}
+		}
+
+		if errNow == nil && errFull == nil {
+			totals.now += float64(now)
+			totals.full += float64(full)
+			totals.batteries++
+		}
+		if errRate == nil {
+			// some batteries report a negative rate when discharging
+			if rate < 0 {
+				rate = -rate
+			}
+			totals.rate += float64(rate)
+		}
+	}
+
+	if batteries == 0 {
+		return nil, fmt.Errorf("no batteries found in %s", root)
+	}
+
+	// energy and charge can't be added, so mixed batteries only get the capacity
+	totals := energy
+	if charge.batteries > 0 {
+		totals = charge
+	}
+	if energy.batteries > 0 && charge.batteries > 0 {
+		totals = batteryTotals{}
+	}
+
+	if totals.full > 0 {
+		result.percent = 100 * totals.now / totals.full
+	} else {
+		result.percent = capacity / float64(batteries)
+	}
+	if result.percent > 100 {
+		result.percent = 100
+	}
+
+	if totals.rate > 0 {
+		hours := 0.0
+		if result.status == batteryDischarging {
+			hours = totals.now / totals.rate
+		} else if result.status == batteryCharging {
+			hours = (totals.full - totals.now) / totals.rate
+		}
+		result.remaining = time.Duration(hours * float64(time.Hour))
+	}
+
+	return result, nil
+}
+
+// batteryTotals sums the batteries reporting in the same unit
+type batteryTotals struct {
+	now, full, rate float64
+	batteries       int
+}
+
+// batteryVoltage returns the design voltage of a battery in µV, or 0 if unknown
+func batteryVoltage(supply string) int64 {
+	for _, name := range []string{"voltage_min_design", "voltage_now"} {
+		if voltage, err := util.ReadFileInt(filepath.Join(supply, name)); err == nil && voltage > 0 {
+			return voltage
+		}
+	}
+	return 0
+}
+
+func parseBatteryStatus(supply string) batteryStatus {
+	status, err := util.ReadFileString(filepath.Join(supply, "status"))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to read battery status: %s", err.Error())
+	}
+
+	switch status {
+	case "Charging":
+		return batteryCharging
+	case "Discharging":
+		return batteryDischarging
+	case "Not charging":
+		return batteryNotCharging
+	case "Full":
+		return batteryFull
+	default:
+		return batteryUnknown
+	}
+}
@@ -0,0 +1,198 @@
+package widget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSysfs creates the attributes of a sysfs device under root
+func writeSysfs(t *testing.T, root string, device string, attributes map[string]string) {
+	t.Helper()
+
+	dir := filepath.Join(root, device)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range attributes {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadBatteryDataEnergy(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/power_supply/AC", map[string]string{
+		"type":   "Mains",
+		"online": "0",
+	})
+	writeSysfs(t, root, "class/power_supply/BAT0", map[string]string{
+		"type":        "Battery",
+		"present":     "1",
+		"status":      "Discharging",
+		"capacity":    "50",
+		"energy_now":  "20000000",
+		"energy_full": "40000000",
+		"power_now":   "10000000",
+	})
+	writeSysfs(t, root, "class/power_supply/BAT1", map[string]string{
+		"type":        "Battery",
+		"present":     "1",
+		"status":      "Unknown",
+		"capacity":    "100",
+		"energy_now":  "20000000",
+		"energy_full": "20000000",
+		"power_now":   "0",
+	})
+
+	data, err := readBatteryData(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 40 of 60 Wh, weighted by energy rather than the average capacity
+	if int(data.percent) != 66 {
+		t.Errorf("percent = %.1f, want 66.7", data.percent)
+	}
+	if data.status != batteryDischarging {
+		t.Errorf("status = %d, want discharging", data.status)
+	}
+	if data.remaining != 4*time.Hour {
+		t.Errorf("remaining = %s, want 4h", data.remaining)
+	}
+}
+
+func TestReadBatteryDataCharge(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/power_supply/BAT0", map[string]string{
+		"type":               "Battery",
+		"status":             "Charging",
+		"charge_now":         "1000000",
+		"charge_full":        "4000000",
+		"current_now":        "-1500000",
+		"voltage_min_design": "10000000",
+	})
+	writeSysfs(t, root, "class/power_supply/BAT1", map[string]string{
+		"type":        "Battery",
+		"status":      "Not charging",
+		"energy_now":  "10000000",
+		"energy_full": "20000000",
+	})
+
+	data, err := readBatteryData(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the charge of BAT0 is 10 of 40 Wh at 10 V, so 20 of 60 Wh in total
+	if int(data.percent) != 33 {
+		t.Errorf("percent = %.1f, want 33.3", data.percent)
+	}
+	if data.status != batteryCharging {
+		t.Errorf("status = %d, want charging", data.status)
+	}
+	// 40 Wh left at 15 W
+	if want := 40 * time.Hour / 15; data.remaining.Round(time.Second) != want.Round(time.Second) {
+		t.Errorf("remaining = %s, want %s", data.remaining, want)
+	}
+}
+
+func TestReadBatteryDataMixedUnits(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/power_supply/BAT0", map[string]string{
+		"type":        "Battery",
+		"status":      "Discharging",
+		"capacity":    "20",
+		"charge_now":  "1000000",
+		"charge_full": "5000000",
+		"current_now": "1000000",
+	})
+	writeSysfs(t, root, "class/power_supply/BAT1", map[string]string{
+		"type":        "Battery",
+		"status":      "Discharging",
+		"capacity":    "60",
+		"energy_now":  "30000000",
+		"energy_full": "50000000",
+		"power_now":   "10000000",
+	})
+
+	data, err := readBatteryData(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// µAh and µWh can't be added without a voltage
+	if data.percent != 40 {
+		t.Errorf("percent = %.1f, want the average capacity 40", data.percent)
+	}
+	if data.remaining != 0 {
+		t.Errorf("remaining = %s, want no estimate", data.remaining)
+	}
+}
+
+func TestReadBatteryDataNone(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/power_supply/BAT0", map[string]string{
+		"type":    "Battery",
+		"present": "0",
+	})
+
+	if _, err := readBatteryData(root); err == nil {
+		t.Error("expected an error without present batteries")
+	}
+}
+
+func TestBatteryHiddenWithoutBatteries(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/power_supply/AC", map[string]string{"type": "Mains", "online": "1"})
+
+	widget := NewBatteryWidget(BatteryConfig{SysfsRoot: root, UPower: true})
+	battery := widget.impl.(*Battery)
+	battery.setup()
+
+	// not polled, and no upower connection to wake it up
+	if widget.Interval != 0 || battery.dbus != nil {
+		t.Errorf("interval %d, dbus %v, want a hidden widget", widget.Interval, battery.dbus)
+	}
+	if widget.block.FullText != "" {
+		t.Errorf("got %q, want an empty block", widget.block.FullText)
+	}
+}
+
+func TestBatteryUpdate(t *testing.T) {
+	tests := []struct {
+		status   string
+		capacity string
+		text     string
+		color    string
+		urgent   bool
+	}{
+		{"Discharging", "50", fmt.Sprintf("%c 50%%", ICON_BATTERY[5]), "", false},
+		{"Discharging", "14", fmt.Sprintf("%c 14%%", ICON_BATTERY[1]), COLOR_WARNING, false},
+		{"Discharging", "8", fmt.Sprintf("%c 8%%", ICON_BATTERY[1]), COLOR_WARNING, true},
+		// a low battery isn't a problem while charging
+		{"Charging", "8", fmt.Sprintf("%c 8%%", ICON_BATTERY_CHARGING), COLOR_GOOD, false},
+		{"Full", "100", fmt.Sprintf("%c 100%%", ICON_BATTERY_PLUGGED), "", false},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		writeSysfs(t, root, "class/power_supply/BAT0", map[string]string{
+			"type":     "Battery",
+			"status":   test.status,
+			"capacity": test.capacity,
+		})
+
+		battery := NewBatteryWidget(BatteryConfig{SysfsRoot: root}).impl.(*Battery)
+		block := &block{}
+		battery.update(block)
+
+		if block.FullText != test.text || block.Color != test.color || block.Urgent != test.urgent {
+			t.Errorf("%s %s%%: got %q color %q urgent %t, want %q color %q urgent %t", test.status, test.capacity,
+				block.FullText, block.Color, block.Urgent, test.text, test.color, test.urgent)
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package widget
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how often calendars are reread
+const CALENDAR_RELOAD = time.Minute
+
+// how far ahead the next event is looked for
+const CALENDAR_LOOKAHEAD = 24 * time.Hour
+
+// calendarEvent is a VEVENT, possibly recurring
+type calendarEvent struct {
+	uid      string
+	summary  string
+	start    time.Time
+	duration time.Duration
+	allDay   bool
+	rule     *recurrenceRule
+	exdates  []time.Time
+}
+
+// recurrenceRule is the supported subset of RRULE. BYDAY limits daily rules,
+// expands weekly and monthly rules, and BYMONTHDAY expands monthly rules.
+// events with other rules, such as BYSETPOS, are skipped
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+}
+
+// weekdayNum is a BYDAY value such as TU, 2TU or -1FR, where ordinal is 0
+// for every such day of the period
+type weekdayNum struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+// eventOccurrence is a single occurrence of an event
+type eventOccurrence struct {
+	summary string
+	start   time.Time
+	end     time.Time
+}
+
+// readCalendars reads the events of iCalendar files and vdir directories
+func readCalendars(paths []string) []*calendarEvent {
+	events := make([]*calendarEvent, 0)
+
+	for _, path := range paths {
+		// vdirsyncer stores one item per file, in a directory per calendar
+		filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("failed to read calendar %s: %s", file, err.Error())
+				return nil
+			} else if entry.IsDir() || !strings.HasSuffix(file, ".ics") {
+				return nil
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Printf("failed to read calendar %s: %s", file, err.Error())
+				return nil
+			}
+
+			events = append(events, parseICalendar(string(data))...)
+			return nil
+		})
+	}
+
+	return events
+}
+
+// nextEvent returns the first occurrence that hasn't ended, ignoring all-day events
+func nextEvent(events []*calendarEvent, now time.Time) *eventOccurrence {
+	var next *eventOccurrence
+	for _, event := range events {
+		if event.allDay {
+			continue
+		}
+
+		start, ok := event.nextOccurrence(now, now.Add(CALENDAR_LOOKAHEAD))
+		if ok && (next == nil || start.Before(next.start)) {
+			next = &eventOccurrence{
+				summary: event.summary,
+				start:   start,
+				end:     start.Add(event.duration),
+			}
+		}
+	}
+	return next
+}
+
+// parseICalendar returns the events of an iCalendar file. cancelled events are
+// skipped, and modified occurrences of recurring events replace the original
+func parseICalendar(data string) []*calendarEvent {
+	// lines starting with whitespace continue the previous line
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	events := make([]*calendarEvent, 0)
+	// RECURRENCE-ID of modified occurrences, by UID
+	overrides := make(map[string][]time.Time)
+
+	var event *calendarEvent
+	var recurrenceId, end time.Time
+	hasDuration := false
+	cancelled := false
+	unsupported := false
+	// set inside components nested in an event, such as VALARM
+	nested := 0
+
+	for _, line := range strings.Split(data, "\n") {
+		name, params, value := parseProperty(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &calendarEvent{}
+			recurrenceId = time.Time{}
+			end = time.Time{}
+			hasDuration = false
+			cancelled = false
+			unsupported = false
+			continue
+		case event == nil:
+			continue
+		case name == "BEGIN":
+			nested++
+			continue
+		case name == "END" && value != "VEVENT":
+			nested--
+			continue
+		case nested > 0:
+			continue
+		}
+
+		switch name {
+		case "END":
+			// also when the occurrence is cancelled
+			if !recurrenceId.IsZero() {
+				overrides[event.uid] = append(overrides[event.uid], recurrenceId)
+			}
+
+			if !event.start.IsZero() && !cancelled && !unsupported {
+				if !end.IsZero() {
+					event.duration = end.Sub(event.start)
+				} else if !hasDuration && event.allDay {
+					event.duration = 24 * time.Hour
+				}
+				events = append(events, event)
+			}
+			event = nil
+
+		case "UID":
+			event.uid = value
+		case "SUMMARY":
+			event.summary = unescapeText(value)
+		case "STATUS":
+			cancelled = value == "CANCELLED"
+		case "DTSTART":
+			event.start, event.allDay, _ = parseICalTime(value, params)
+		case "DTEND":
+			end, _, _ = parseICalTime(value, params)
+		case "DURATION":
+			if duration, err := parseICalDuration(value); err == nil {
+				event.duration = duration
+				hasDuration = true
+			}
+		case "RRULE":
+			if rule, err := parseRecurrenceRule(value); err != nil {
+				// better no event than one at the wrong time
+				unsupported = true
+			} else {
+				event.rule = rule
+			}
+		case "EXDATE":
+			for _, date := range strings.Split(value, ",") {
+				if exdate, _, err := parseICalTime(date, params); err == nil {
+					event.exdates = append(event.exdates, exdate)
+				}
+			}
+		case "RECURRENCE-ID":
+			recurrenceId, _, _ = parseICalTime(value, params)
+		}
+	}
+
+	for _, event := range events {
+		if event.rule != nil {
+			event.exdates = append(event.exdates, overrides[event.uid]...)
+		}
+	}
+
+	return events
+}
+
+// parseProperty splits a content line such as DTSTART;TZID=Europe/Oslo:20240101T090000
+func parseProperty(line string) (string, map[string]string, string) {
+	// the value starts at the first colon outside of quoted parameters
+	quoted := false
+	colon := -1
+	for idx, char := range line {
+		if char == '"' {
+			quoted = !quoted
+		} else if char == ':' && !quoted {
+			colon = idx
+			break
+		}
+	}
+	if colon == -1 {
+		return "", nil, ""
+	}
+
+	fields := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, param := range fields[1:] {
+		if key, value, found := strings.Cut(param, "="); found {
+			params[strings.ToUpper(key)] = strings.Trim(value, "\"")
+		}
+	}
+
+	return strings.ToUpper(fields[0]), params, strings.TrimSpace(line[colon+1:])
+}
+
+// parseICalTime parses a DATE or DATE-TIME, which is either UTC, in the TZID
+// parameter or floating in the local time zone
+func parseICalTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		date, err := time.ParseInLocation("20060102", value, time.Local)
+		return date, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		date, err := time.Parse("20060102T150405Z", value)
+		return date, false, err
+	}
+
+	location := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		// windows time zone names aren't known, so they fall back to local time
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			location = tz
+		}
+	}
+
+	date, err := time.ParseInLocation("20060102T150405", value, location)
+	return date, false, err
+}
+
+// parseICalDuration parses a duration such as PT1H30M or P1D
+func parseICalDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+	}
+	value = strings.TrimLeft(value, "+-")
+
+	if !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+
+	var duration time.Duration
+	number := ""
+	for _, char := range []byte(value[1:]) {
+		if char >= '0' && char <= '9' {
+			number += string(char)
+		} else if unit, exists := units[char]; exists {
+			n, err := strconv.Atoi(number)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s", value)
+			}
+			duration += time.Duration(n) * unit
+			number = ""
+		} else if char != 'T' {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+	}
+
+	return sign * duration, nil
+}
+
+// parseRecurrenceRule parses an RRULE value such as FREQ=WEEKLY;BYDAY=MO,WE,
+// and returns an error for rules that can't be expanded
+func parseRecurrenceRule(value string) (*recurrenceRule, error) {
+	weekdays := map[string]time.Weekday{
+		"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+		"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+	}
+
+	rule := &recurrenceRule{interval: 1}
+	weekStart := "MO"
+	for _, part := range strings.Split(value, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "FREQ":
+			rule.freq = value
+		case "INTERVAL":
+			if interval, err := strconv.Atoi(value); err == nil && interval > 0 {
+				rule.interval = interval
+			}
+		case "COUNT":
+			rule.count, _ = strconv.Atoi(value)
+		case "UNTIL":
+			rule.until, _, _ = parseICalTime(value, nil)
+		case "WKST":
+			weekStart = value
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				name := strings.TrimLeft(day, "+-0123456789")
+				weekday, exists := weekdays[name]
+				if !exists {
+					return nil, fmt.Errorf("invalid BYDAY %s", day)
+				}
+
+				ordinal := 0
+				if number := strings.TrimSuffix(day, name); number != "" {
+					var err error
+					if ordinal, err = strconv.Atoi(number); err != nil || ordinal == 0 {
+						return nil, fmt.Errorf("invalid BYDAY %s", day)
+					}
+				}
+				rule.byDay = append(rule.byDay, weekdayNum{ordinal: ordinal, weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %s", day)
+				}
+				rule.byMonthDay = append(rule.byMonthDay, monthDay)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	ordinals := false
+	for _, day := range rule.byDay {
+		ordinals = ordinals || day.ordinal != 0
+	}
+
+	switch {
+	case rule.freq != "DAILY" && rule.freq != "WEEKLY" && rule.freq != "MONTHLY" && rule.freq != "YEARLY":
+		return nil, fmt.Errorf("unsupported frequency %s", rule.freq)
+	case len(rule.byMonthDay) > 0 && rule.freq != "MONTHLY":
+		return nil, fmt.Errorf("BYMONTHDAY is only supported in monthly rules")
+	case len(rule.byMonthDay) > 0 && len(rule.byDay) > 0:
+		return nil, fmt.Errorf("BYDAY and BYMONTHDAY together are not supported")
+	case len(rule.byDay) > 0 && rule.freq == "YEARLY":
+		return nil, fmt.Errorf("BYDAY is not supported in yearly rules")
+	case ordinals && rule.freq != "MONTHLY":
+		return nil, fmt.Errorf("BYDAY ordinals are only supported in monthly rules")
+	case weekStart != "MO" && rule.freq == "WEEKLY" && rule.interval > 1 && len(rule.byDay) > 1:
+		// the days of a week depend on where it starts
+		return nil, fmt.Errorf("WKST %s is not supported", weekStart)
+	}
+
+	// sorted from monday, the default start of the week
+	sort.Slice(rule.byDay, func(i, j int) bool {
+		return (rule.byDay[i].weekday+6)%7 < (rule.byDay[j].weekday+6)%7
+	})
+
+	return rule, nil
+}
+
+// nextOccurrence returns the start of the first occurrence that ends after
+// from and starts before to
+func (e *calendarEvent) nextOccurrence(from time.Time, to time.Time) (time.Time, bool) {
+	if e.rule == nil {
+		return e.start, e.start.Add(e.duration).After(from) && e.start.Before(to)
+	}
+
+	rule := e.rule
+	generated := 0
+
+	// skip periods that ended long ago, unless the occurrences must be counted
+	period := 0
+	if rule.count == 0 {
+		days := int(from.Add(-e.duration).Sub(e.start).Hours() / 24)
+		switch rule.freq {
+		case "DAILY":
+			period = days/rule.interval - 1
+		case "WEEKLY":
+			period = days/(7*rule.interval) - 1
+		}
+		if period < 0 {
+			period = 0
+		}
+	}
+
+	for ; period < 100000; period++ {
+		for _, start := range e.periodStarts(period) {
+			if start.Before(e.start) {
+				continue
+			} else if !start.Before(to) || (!rule.until.IsZero() && start.After(rule.until)) {
+				return time.Time{}, false
+			}
+
+			generated++
+			if rule.count > 0 && generated > rule.count {
+				return time.Time{}, false
+			}
+
+			if start.Add(e.duration).After(from) && !e.excluded(start) {
+				return start, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// periodStarts returns the candidate starts in a period of the rule, where
+// period 0 contains the first occurrence
+func (e *calendarEvent) periodStarts(period int) []time.Time {
+	rule := e.rule
+	step := period * rule.interval
+	at := func(date time.Time) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), e.start.Hour(), e.start.Minute(), e.start.Second(), 0, e.start.Location())
+	}
+
+	switch rule.freq {
+	case "DAILY":
+		date := e.start.AddDate(0, 0, step)
+		if len(rule.byDay) > 0 && !rule.onWeekday(date.Weekday()) {
+			return nil
+		}
+		return []time.Time{at(date)}
+
+	case "WEEKLY":
+		if len(rule.byDay) == 0 {
+			return []time.Time{at(e.start.AddDate(0, 0, 7*step))}
+		}
+
+		// from the monday of the week
+		monday := e.start.AddDate(0, 0, 7*step-int(e.start.Weekday()+6)%7)
+		starts := make([]time.Time, len(rule.byDay))
+		for idx, day := range rule.byDay {
+			starts[idx] = at(monday.AddDate(0, 0, int(day.weekday+6)%7))
+		}
+		return starts
+
+	case "MONTHLY":
+		first := time.Date(e.start.Year(), e.start.Month()+time.Month(step), 1, 0, 0, 0, 0, e.start.Location())
+		if len(rule.byDay) == 0 && len(rule.byMonthDay) == 0 {
+			// e.g. the 31st is skipped in shorter months
+			return e.monthDays(first, []int{e.start.Day()})
+		} else if len(rule.byMonthDay) > 0 {
+			return e.monthDays(first, rule.byMonthDay)
+		}
+
+		days := make([]int, 0)
+		count := first.AddDate(0, 1, -1).Day()
+		for _, day := range rule.byDay {
+			// the first such weekday of the month, and how many there are
+			firstDay := 1 + (int(day.weekday)-int(first.Weekday())+7)%7
+			occurrences := (count-firstDay)/7 + 1
+
+			if day.ordinal == 0 {
+				for n := 0; n < occurrences; n++ {
+					days = append(days, firstDay+7*n)
+				}
+			} else if day.ordinal > 0 && day.ordinal <= occurrences {
+				days = append(days, firstDay+7*(day.ordinal-1))
+			} else if day.ordinal < 0 && -day.ordinal <= occurrences {
+				days = append(days, firstDay+7*(occurrences+day.ordinal))
+			}
+		}
+		return e.monthDays(first, days)
+
+	case "YEARLY":
+		date := e.start.AddDate(step, 0, 0)
+		// the 29th of february only occurs in leap years
+		if date.Day() != e.start.Day() {
+			return nil
+		}
+		return []time.Time{at(date)}
+	}
+
+	return nil
+}
+
+// onWeekday returns true if a weekday is in BYDAY
+func (r *recurrenceRule) onWeekday(weekday time.Weekday) bool {
+	for _, day := range r.byDay {
+		if day.weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// monthDays returns the sorted starts on days of a month, where negative days
+// count from the end. days the month doesn't have are skipped
+func (e *calendarEvent) monthDays(first time.Time, days []int) []time.Time {
+	count := first.AddDate(0, 1, -1).Day()
+
+	sorted := make([]int, 0, len(days))
+	for _, day := range days {
+		if day < 0 {
+			day += count + 1
+		}
+		if day >= 1 && day <= count {
+			sorted = append(sorted, day)
+		}
+	}
+	sort.Ints(sorted)
+
+	starts := make([]time.Time, 0, len(sorted))
+	for idx, day := range sorted {
+		if idx > 0 && day == sorted[idx-1] {
+			continue
+		}
+		starts = append(starts, time.Date(first.Year(), first.Month(), day,
+			e.start.Hour(), e.start.Minute(), e.start.Second(), 0, e.start.Location()))
+	}
+	return starts
+}
+
+func (e *calendarEvent) excluded(start time.Time) bool {
+	for _, exdate := range e.exdates {
+		if exdate.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeText unescapes a TEXT value
+func unescapeText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// formatMonth returns the lines of a month calendar with ISO week numbers,
+// where today is passed through highlight
+func formatMonth(now time.Time, highlight func(day string) string) []string {
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	lines := []string{
+		fmt.Sprintf("%s %d", now.Month(), now.Year()),
+		"Wk  Mo Tu We Th Fr Sa Su",
+	}
+
+	// from the monday of the first week
+	day := first.AddDate(0, 0, -int(first.Weekday()+6)%7)
+	for day.Month() == now.Month() || day.Before(first) {
+		_, week := day.ISOWeek()
+		line := fmt.Sprintf("%2d ", week)
+
+		for i := 0; i < 7; i++ {
+			cell := "   "
+			if day.Month() == now.Month() {
+				cell = fmt.Sprintf("%3d", day.Day())
+				if day.Day() == now.Day() {
+					cell = highlight(cell)
+				}
+			}
+			line += cell
+			day = day.AddDate(0, 0, 1)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
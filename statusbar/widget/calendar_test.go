@@ -0,0 +1,231 @@
+package widget
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// readTestCalendar returns the events of testdata/calendar.ics by summary
+func readTestCalendar(t *testing.T) map[string]*calendarEvent {
+	t.Helper()
+
+	events := make(map[string]*calendarEvent)
+	for _, event := range readCalendars([]string{"testdata/calendar.ics"}) {
+		if _, exists := events[event.summary]; exists {
+			t.Fatalf("duplicate event %q", event.summary)
+		}
+		events[event.summary] = event
+	}
+	return events
+}
+
+// oslo returns a time in Europe/Oslo
+func oslo(t *testing.T, year int, month time.Month, day int, hour int, min int) time.Time {
+	t.Helper()
+
+	zone, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Date(year, month, day, hour, min, 0, 0, zone)
+}
+
+func TestParseICalendar(t *testing.T) {
+	events := readTestCalendar(t)
+
+	// cancelled events, the cancelled occurrence and rules with BYSETPOS are skipped,
+	// and the summary of the alarm doesn't replace that of the event
+	want := []string{"Standup", "Standup (moved)", "Gym, early", "Planning", "Retro", "Report",
+		"Rent", "Leap day", "One on one", "Holiday", "Lunch"}
+	if len(events) != len(want) {
+		t.Errorf("got %d events, want %d", len(events), len(want))
+	}
+	for _, summary := range want {
+		if _, exists := events[summary]; !exists {
+			t.Errorf("missing event %q", summary)
+		}
+	}
+
+	standup := events["Standup"]
+	if standup == nil {
+		t.FailNow()
+	}
+	if !standup.start.Equal(oslo(t, 2024, 1, 1, 9, 0)) || standup.duration != 15*time.Minute {
+		t.Errorf("standup starts %s for %s, want 2024-01-01 09:00 for 15m", standup.start, standup.duration)
+	}
+	// the EXDATE, followed by the moved and the cancelled occurrence
+	if len(standup.exdates) != 3 {
+		t.Errorf("standup has %d exdates, want 3", len(standup.exdates))
+	}
+
+	if gym := events["Gym, early"]; gym != nil && (gym.start.Location() != time.UTC || gym.duration != 30*time.Minute) {
+		t.Errorf("gym starts %s for %s, want UTC for 30m", gym.start, gym.duration)
+	}
+
+	holiday := events["Holiday"]
+	if holiday != nil && (!holiday.allDay || holiday.duration != 24*time.Hour ||
+		!holiday.start.Equal(time.Date(2024, 1, 5, 0, 0, 0, 0, time.Local))) {
+		t.Errorf("holiday starts %s for %s, all day %t, want a local day", holiday.start, holiday.duration, holiday.allDay)
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	events := readTestCalendar(t)
+	year := 365 * 24 * time.Hour
+
+	tests := []struct {
+		summary string
+		from    time.Time
+		// zero when there is no occurrence within a year
+		want time.Time
+	}{
+		// an occurrence is returned until it ends
+		{"Standup", oslo(t, 2024, 1, 1, 8, 0), oslo(t, 2024, 1, 1, 9, 0)},
+		{"Standup", oslo(t, 2024, 1, 8, 9, 10), oslo(t, 2024, 1, 8, 9, 0)},
+		{"Standup", oslo(t, 2024, 1, 1, 9, 20), oslo(t, 2024, 1, 3, 9, 0)},
+		// skips the EXDATE, the moved and the cancelled occurrence
+		{"Standup", oslo(t, 2024, 1, 8, 9, 20), oslo(t, 2024, 1, 22, 9, 0)},
+		{"Standup (moved)", oslo(t, 2024, 1, 9, 0, 0), oslo(t, 2024, 1, 15, 10, 0)},
+		// the last before UNTIL
+		{"Standup", oslo(t, 2024, 3, 26, 0, 0), oslo(t, 2024, 3, 27, 9, 0)},
+		{"Standup", oslo(t, 2024, 3, 28, 0, 0), time.Time{}},
+
+		// daily on weekdays, five times
+		{"Gym, early", time.Date(2024, 1, 5, 8, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 7, 0, 0, 0, time.UTC)},
+		{"Gym, early", time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC), time.Time{}},
+
+		// every second week, three times
+		{"One on one", oslo(t, 2024, 1, 4, 0, 0), oslo(t, 2024, 1, 17, 14, 0)},
+		{"One on one", oslo(t, 2024, 1, 18, 0, 0), oslo(t, 2024, 1, 31, 14, 0)},
+		{"One on one", oslo(t, 2024, 2, 1, 0, 0), time.Time{}},
+
+		// the second tuesday and the last friday of the month
+		{"Planning", oslo(t, 2024, 1, 10, 0, 0), oslo(t, 2024, 2, 13, 13, 0)},
+		{"Planning", oslo(t, 2024, 8, 1, 0, 0), oslo(t, 2024, 8, 13, 13, 0)},
+		{"Retro", oslo(t, 2024, 1, 27, 0, 0), oslo(t, 2024, 2, 23, 15, 0)},
+		{"Retro", oslo(t, 2024, 2, 24, 0, 0), oslo(t, 2024, 3, 29, 15, 0)},
+
+		// the last day of the month, and the 31st which february doesn't have
+		{"Report", oslo(t, 2024, 2, 1, 0, 0), oslo(t, 2024, 2, 29, 8, 0)},
+		{"Rent", oslo(t, 2024, 2, 1, 0, 0), oslo(t, 2024, 3, 31, 8, 0)},
+		{"Leap day", oslo(t, 2024, 3, 1, 0, 0), time.Time{}},
+
+		{"Lunch", time.Date(2024, 1, 5, 12, 30, 0, 0, time.UTC), time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"Lunch", time.Date(2024, 1, 5, 13, 0, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, test := range tests {
+		event := events[test.summary]
+		if event == nil {
+			t.Errorf("missing event %q", test.summary)
+			continue
+		}
+
+		start, ok := event.nextOccurrence(test.from, test.from.Add(year))
+		if ok != !test.want.IsZero() || (ok && !start.Equal(test.want)) {
+			t.Errorf("%s from %s: got %s %t, want %s", test.summary, test.from, start, ok, test.want)
+		}
+	}
+
+	// only in leap years, so beyond the year
+	leap := events["Leap day"]
+	if start, ok := leap.nextOccurrence(oslo(t, 2024, 3, 1, 0, 0), oslo(t, 2029, 1, 1, 0, 0)); !ok || !start.Equal(oslo(t, 2028, 2, 29, 12, 0)) {
+		t.Errorf("leap day: got %s %t, want 2028-02-29 12:00", start, ok)
+	}
+}
+
+func TestNextEvent(t *testing.T) {
+	events := readCalendars([]string{"testdata/calendar.ics"})
+
+	// the all-day holiday is ignored
+	next := nextEvent(events, time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC))
+	if next == nil || next.summary != "Lunch" || !next.end.Equal(time.Date(2024, 1, 5, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v, want lunch until 13:00", next)
+	}
+
+	// the standup on monday is more than a day away
+	if next := nextEvent(events, time.Date(2024, 1, 6, 13, 30, 0, 0, time.UTC)); next != nil {
+		t.Errorf("got %+v, want no event within a day", next)
+	}
+}
+
+func TestParseRecurrenceRule(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;WKST=MO", true},
+		{"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20240331T000000Z", true},
+		{"FREQ=MONTHLY;BYDAY=2TU,-1FR", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", true},
+		{"FREQ=YEARLY;COUNT=10", true},
+		{"FREQ=HOURLY", false},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", false},
+		{"FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", false},
+		{"FREQ=WEEKLY;BYDAY=2TU", false},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", false},
+		{"FREQ=MONTHLY;BYDAY=XX", false},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,MO;WKST=SU", false},
+	}
+
+	for _, test := range tests {
+		if _, err := parseRecurrenceRule(test.value); (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, want ok %t", test.value, err, test.ok)
+		}
+	}
+}
+
+func TestParseProperty(t *testing.T) {
+	name, params, value := parseProperty(`dtstart;TZID="America/New_York";x-label="a:b":20240101T090000`)
+	if name != "DTSTART" || params["TZID"] != "America/New_York" || params["X-LABEL"] != "a:b" || value != "20240101T090000" {
+		t.Errorf("got %s %v %s", name, params, value)
+	}
+
+	if name, _, _ := parseProperty("no colon"); name != "" {
+		t.Errorf("got %q, want no property", name)
+	}
+}
+
+func TestParseICalDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT1H30M":   90 * time.Minute,
+		"P1D":       24 * time.Hour,
+		"P1W":       7 * 24 * time.Hour,
+		"P1DT2H3S":  26*time.Hour + 3*time.Second,
+		"-PT15M":    -15 * time.Minute,
+		"+PT10M20S": 10*time.Minute + 20*time.Second,
+	}
+
+	for value, want := range tests {
+		if got, err := parseICalDuration(value); err != nil || got != want {
+			t.Errorf("%s: got %s %v, want %s", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"1H", "PT1X", "PTH"} {
+		if _, err := parseICalDuration(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestFormatMonth(t *testing.T) {
+	lines := formatMonth(time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC), func(day string) string {
+		return "[" + strings.TrimSpace(day) + "]"
+	})
+
+	want := []string{
+		"February 2024",
+		"Wk  Mo Tu We Th Fr Sa Su",
+		" 5            1  2  3  4",
+		" 6   5  6  7  8  9 10 11",
+		" 7  12 13[14] 15 16 17 18",
+		" 8  19 20 21 22 23 24 25",
+		" 9  26 27 28 29         ",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
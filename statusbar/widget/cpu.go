@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -14,28 +15,59 @@ import (
 
 const STATFILE = "/proc/stat"
 
+// glyphs for per-core usage, from idle to fully busy
+var CPU_BARS = []rune("▁▂▃▄▅▆▇█")
+
+type CpuConfig struct {
+	// StatFile is the path to the kernel cpu statistics, defaults to /proc/stat
+	StatFile string
+	// SysfsRoot is the mount point of sysfs, defaults to /sys
+	SysfsRoot string
+
+	// PerCore shows the usage of every core as a strip of bar glyphs
+	PerCore bool
+	// HighlightBusiest colors the bar of the busiest core, requires PerCore
+	HighlightBusiest bool
+	// Frequency shows the average current frequency of all cores
+	Frequency bool
+}
+
 type Cpu struct {
 	*Widget
-	cpuData   [][]int
-	prevIdle  int
-	prevTotal int
+	config  CpuConfig
+	cpuData [][]int
+
+	// previous idle and total time of each row in the stat file,
+	// the first row is the sum of all cores
+	prevIdle  []int
+	prevTotal []int
 	statFile  *os.File
+
+	topProcess topProcessView
 }
 
-func NewCpuWidget() *Widget {
+func NewCpuWidget(config CpuConfig) *Widget {
+	if config.StatFile == "" {
+		config.StatFile = STATFILE
+	}
+	if config.SysfsRoot == "" {
+		config.SysfsRoot = "/sys"
+	}
+
 	return newWidget("cpu", 4000, func(widget *Widget) impl {
 		return &Cpu{
 			Widget:    widget,
+			config:    config,
 			cpuData:   make([][]int, 0),
-			prevIdle:  -1,
-			prevTotal: -1,
+			prevIdle:  make([]int, 0),
+			prevTotal: make([]int, 0),
 		}
 	})
 }
 
 func (c *Cpu) setup() {
-	if statFile, err := os.Open(STATFILE); err != nil {
-		log.Fatalf("failed to open %s: %s", STATFILE, err.Error())
+	if statFile, err := os.Open(c.config.StatFile); err != nil {
+		log.Fatalf("failed to open %s: %s", c.config.StatFile, err.Error())
 	} else {
 		c.statFile = statFile
 	}
@@ -49,28 +81,133 @@ func (c *Cpu) run() {}
 
 func (c *Cpu) update(block *block) {
 	c.readCpuData()
+	usage := c.calculateUsage()
+
+	if c.topProcess.active() {
+		block.FullText = "CPU " + c.topProcess.text
+		block.Markup = ""
+		return
+	}
+
+	block.FullText = fmt.Sprintf("CPU %.2f%%", usage[0])
+	block.Markup = ""
+
+	if c.config.PerCore && len(usage) > 1 {
+		block.FullText += " " + c.formatCores(usage[1:])
+		if c.config.HighlightBusiest {
+			block.Markup = "pango"
+		}
+	}
+
+	if c.config.Frequency {
+		if freq, err := c.readFrequency(); err != nil {
+			log.Printf("failed to read cpu frequency: %s", err.Error())
+		} else {
+			block.FullText += fmt.Sprintf(" %.1fGHz", freq)
+		}
+	}
+}
+
+// left or right click shows the process using the most cpu
+func (c *Cpu) onClick(x int, y int, btn int) {
+	if btn != 1 && btn != 3 {
+		return
+	}
+
+	go func() {
+		if top, err := topCpuProcess(); err != nil {
+			log.Printf("failed to find top process: %s", err.Error())
+		} else {
+			c.showTopProcess(&c.topProcess, top.String())
+		}
+	}()
+}
+
+// calculateUsage returns the usage percentage of every row since the previous call
+func (c *Cpu) calculateUsage() []float64 {
+	usage := make([]float64, len(c.cpuData))
+
+	for row, data := range c.cpuData {
+		// idle + iowait
+		idle := data[3] + data[4]
+		// total cpu time
+		total := util.Sum(data)
 
-	usagePercent := 0.0
+		if len(c.prevIdle) < row+1 {
+			c.prevIdle = append(c.prevIdle, -1)
+			c.prevTotal = append(c.prevTotal, -1)
+		}
 
-	all := c.cpuData[0]
-	// idle + iowait
-	idle := all[3] + all[4]
-	// total cpu time
-	total := util.Sum(all)
+		if c.prevIdle[row] != -1 {
+			idleDelta := float64(idle - c.prevIdle[row])
+			totalDelta := float64(total - c.prevTotal[row])
+			if totalDelta > 0 {
+				usage[row] = 100 * (1 - idleDelta/totalDelta)
+			}
+		}
 
-	if c.prevIdle != -1 {
-		idleDelta := float64(idle - c.prevIdle)
-		totalDelta := float64(total - c.prevTotal)
-		usagePercent = 100 * (1 - idleDelta/totalDelta)
+		c.prevIdle[row] = idle
+		c.prevTotal[row] = total
 	}
 
-	c.prevIdle = idle
-	c.prevTotal = total
+	return usage
+}
+
+// formatCores renders per-core usage as bar glyphs
+func (c *Cpu) formatCores(usage []float64) string {
+	busiest := 0
+	for idx, percent := range usage {
+		if percent > usage[busiest] {
+			busiest = idx
+		}
+	}
+
+	var sb strings.Builder
+	for idx, percent := range usage {
+		level := int(percent / 100 * float64(len(CPU_BARS)))
+		if level >= len(CPU_BARS) {
+			level = len(CPU_BARS) - 1
+		} else if level < 0 {
+			level = 0
+		}
 
-	block.FullText = fmt.Sprintf("CPU %.2f%%", usagePercent)
+		if c.config.HighlightBusiest && idx == busiest && percent > 0 {
+			sb.WriteString(fmt.Sprintf("<span foreground=\"%s\">%c</span>", COLOR_WARNING, CPU_BARS[level]))
+		} else {
+			sb.WriteRune(CPU_BARS[level])
+		}
+	}
+
+	return sb.String()
 }
 
-func (c *Cpu) onClick(x int, y int, btn int) {}
+// readFrequency returns the average current frequency of all cores in GHz,
+// skipping cores whose frequency can't be read
+func (c *Cpu) readFrequency() (float64, error) {
+	files, _ := filepath.Glob(filepath.Join(c.config.SysfsRoot, "devices/system/cpu/cpu*/cpufreq/scaling_cur_freq"))
+	if len(files) == 0 {
+		return 0, fmt.Errorf("cpufreq not available")
+	}
+
+	var sum int64
+	var lastErr error
+	readable := 0
+	for _, file := range files {
+		// in kHz
+		freq, err := util.ReadFileInt(file)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sum += freq
+		readable++
+	}
+
+	if readable == 0 {
+		return 0, lastErr
+	}
+	return float64(sum) / float64(readable) / 1e6, nil
+}
 
 func (c *Cpu) readCpuData() {
 	c.statFile.Seek(0, io.SeekStart)
@@ -0,0 +1,117 @@
+package widget
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestCpu returns a cpu widget reading a copy of the first stat snapshot,
+// the path of the copy is returned so the next snapshot can be written to it
+func newTestCpu(t *testing.T, config CpuConfig) (*Cpu, string) {
+	t.Helper()
+
+	config.StatFile = filepath.Join(t.TempDir(), "stat")
+	copyFixture(t, "testdata/stat1", config.StatFile)
+
+	cpu := NewCpuWidget(config).impl.(*Cpu)
+	cpu.setup()
+	t.Cleanup(cpu.close)
+	return cpu, config.StatFile
+}
+
+func copyFixture(t *testing.T, fixture string, path string) {
+	t.Helper()
+
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCpuUsage(t *testing.T) {
+	cpu, statFile := newTestCpu(t, CpuConfig{})
+
+	cpu.readCpuData()
+	cpu.calculateUsage()
+
+	copyFixture(t, "testdata/stat2", statFile)
+	cpu.readCpuData()
+	usage := cpu.calculateUsage()
+
+	want := []float64{46.25, 10, 75, 100, 0}
+	if len(usage) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(usage), len(want))
+	}
+	for row := range want {
+		if math.Abs(usage[row]-want[row]) > 1e-9 {
+			t.Errorf("row %d: got %.2f%%, want %.2f%%", row, usage[row], want[row])
+		}
+	}
+}
+
+func TestCpuFormatCores(t *testing.T) {
+	tests := []struct {
+		usage []float64
+		want  string
+	}{
+		{[]float64{0, 12.4, 12.5, 50, 87.5, 100}, "▁▁▂▅██"},
+		// a busy core is never shown above the top glyph
+		{[]float64{130, -5}, "█▁"},
+	}
+
+	cpu := &Cpu{}
+	for _, test := range tests {
+		if got := cpu.formatCores(test.usage); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.usage, got, test.want)
+		}
+	}
+}
+
+func TestCpuHighlightBusiest(t *testing.T) {
+	cpu, statFile := newTestCpu(t, CpuConfig{PerCore: true, HighlightBusiest: true})
+
+	block := &block{}
+	cpu.update(block)
+
+	copyFixture(t, "testdata/stat2", statFile)
+	cpu.update(block)
+
+	want := fmt.Sprintf("CPU 46.25%% ▁▇<span foreground=\"%s\">█</span>▁", COLOR_WARNING)
+	if block.FullText != want {
+		t.Errorf("got %q, want %q", block.FullText, want)
+	}
+	if block.Markup != "pango" {
+		t.Errorf("markup %q, want pango", block.Markup)
+	}
+
+	// idle cores aren't highlighted
+	if got := cpu.formatCores([]float64{0, 0}); got != "▁▁" {
+		t.Errorf("got %q for idle cores", got)
+	}
+}
+
+func TestCpuFrequency(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "devices/system/cpu/cpu0/cpufreq", map[string]string{"scaling_cur_freq": "2000000"})
+	writeSysfs(t, root, "devices/system/cpu/cpu1/cpufreq", map[string]string{"scaling_cur_freq": "3000000"})
+	// an unreadable core is skipped rather than failing the widget
+	if err := os.MkdirAll(filepath.Join(root, "devices/system/cpu/cpu2/cpufreq/scaling_cur_freq"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := &Cpu{config: CpuConfig{SysfsRoot: root}}
+	if freq, err := cpu.readFrequency(); err != nil || freq != 2.5 {
+		t.Errorf("got %.2f, %v, want 2.5", freq, err)
+	}
+
+	cpu.config.SysfsRoot = t.TempDir()
+	if _, err := cpu.readFrequency(); err == nil {
+		t.Error("expected an error without cpufreq")
+	}
+}
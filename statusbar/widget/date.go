@@ -1,31 +1,220 @@
 package widget
 
 import (
+	"fmt"
+	"log"
+	"strings"
 	"time"
+
+	"github.com/haakonleg/statusbar-sway/util"
 )
 
-const layout string = "Mon 02-01-06 15:04"
+// nf-md-calendar
+const ICON_CALENDAR = '󰃭'
+
+type DateConfig struct {
+	// formats in Go reference layout, or strftime if they contain a %.
+	// {week} is replaced with the ISO week number in either.
+	// Format defaults to "Mon 02-01-06 15:04"
+	Format string
+	// LongFormat is shown after clicking, defaults to "Monday 2 January 2006 15:04:05 W{week}"
+	LongFormat string
+
+	// TimeZone is an IANA time zone such as Europe/Oslo, defaults to the local time zone
+	TimeZone string
+	// Zones are extra time zones cycled through by scrolling
+	Zones []string
+
+	// CalendarLauncher is the dmenu style command the month calendar is shown in
+	// on right click, it is shown in a notification if unset
+	CalendarLauncher []string
+	// Calendars are iCalendar files or vdir directories, such as those synced by
+	// vdirsyncer. the next event within a day is shown after the date. events
+	// repeating by rules such as BYSETPOS are skipped
+	Calendars []string
+	// EventWarning is how many minutes before an event the widget is set urgent, defaults to 5
+	EventWarning int
+}
 
 type Date struct {
 	*Widget
+	config DateConfig
+
+	// the configured time zone first, followed by the extra zones
+	zones     []*time.Location
+	zoneIndex int
+	long      bool
+
+	nextEvent *eventOccurrence
 }
 
-func NewDateWidget() *Widget {
+func NewDateWidget(config DateConfig) *Widget {
+	if config.Format == "" {
+		config.Format = "Mon 02-01-06 15:04"
+	}
+	if config.LongFormat == "" {
+		config.LongFormat = "Monday 2 January 2006 15:04:05 W{week}"
+	}
+	if config.EventWarning == 0 {
+		config.EventWarning = 5
+	}
+
 	return newWidget("date", 1000, func(widget *Widget) impl {
 		return &Date{
 			Widget: widget,
+			config: config,
 		}
 	})
 }
 
-func (d *Date) setup() {}
+func (d *Date) setup() {
+	zone := time.Local
+	if d.config.TimeZone != "" {
+		if location, err := time.LoadLocation(d.config.TimeZone); err != nil {
+			log.Printf("failed to load time zone %s: %s", d.config.TimeZone, err.Error())
+		} else {
+			zone = location
+		}
+	}
+	d.zones = []*time.Location{zone}
+
+	for _, name := range d.config.Zones {
+		if location, err := time.LoadLocation(name); err != nil {
+			log.Printf("failed to load time zone %s: %s", name, err.Error())
+		} else {
+			d.zones = append(d.zones, location)
+		}
+	}
+}
 
 func (d *Date) close() {}
 
-func (d *Date) run() {}
+// reread the calendars now and then
+func (d *Date) run() {
+	if len(d.config.Calendars) == 0 {
+		return
+	}
+
+	for {
+		next := nextEvent(readCalendars(d.config.Calendars), time.Now())
+
+		d.block.Lock()
+		d.nextEvent = next
+		d.block.Unlock()
+
+		d.sendUpdate()
+		time.Sleep(CALENDAR_RELOAD)
+	}
+}
 
 func (d *Date) update(block *block) {
-	block.FullText = time.Now().Format(layout)
+	format := d.config.Format
+	if d.long {
+		format = d.config.LongFormat
+	}
+
+	zone := d.zones[d.zoneIndex]
+	block.FullText = formatDate(format, time.Now().In(zone))
+
+	// the configured zone is shown without its name
+	if d.zoneIndex > 0 {
+		block.FullText += " " + zoneName(zone)
+	}
+
+	block.Urgent = false
+	if event := d.nextEvent; event != nil && event.end.After(time.Now()) {
+		block.FullText += fmt.Sprintf("  %c %s %s", ICON_CALENDAR, formatEventStart(event.start.In(zone)), event.summary)
+
+		untilStart := time.Until(event.start)
+		block.Urgent = untilStart >= 0 && untilStart <= time.Duration(d.config.EventWarning)*time.Minute
+	}
+}
+
+// left click toggles the long format, right click shows the calendar and
+// scrolling cycles through the time zones
+func (d *Date) onClick(x int, y int, btn int) {
+	// the format and zone are read by update in the update loop
+	d.block.Lock()
+	if btn == 3 {
+		zone := d.zones[d.zoneIndex]
+		d.block.Unlock()
+
+		go d.showCalendar(zone)
+		return
+	}
+
+	changed := true
+	switch btn {
+	case 1:
+		d.long = !d.long
+	case 4:
+		d.zoneIndex = (d.zoneIndex + 1) % len(d.zones)
+	case 5:
+		d.zoneIndex = (d.zoneIndex + len(d.zones) - 1) % len(d.zones)
+	default:
+		changed = false
+	}
+	d.block.Unlock()
+
+	if changed {
+		d.sendUpdate()
+	}
 }
 
-func (c *Date) onClick(x int, y int, btn int) {}
+// showCalendar shows the current month in the launcher or a notification
+func (d *Date) showCalendar(zone *time.Location) {
+	now := time.Now().In(zone)
+
+	if len(d.config.CalendarLauncher) > 0 {
+		// e.g. " 18" becomes "*18", launchers don't support markup
+		lines := formatMonth(now, func(day string) string {
+			return fmt.Sprintf("%3s", "*"+strings.TrimSpace(day))
+		})
+		if _, err := util.RunLauncher(d.config.CalendarLauncher, lines); err != nil {
+			log.Printf("failed to show calendar: %s", err.Error())
+		}
+		return
+	}
+
+	lines := formatMonth(now, func(day string) string {
+		return "<b>" + day + "</b>"
+	})
+	if err := util.Notify(lines[0], strings.Join(lines[1:], "\n")); err != nil {
+		log.Printf("failed to show calendar: %s", err.Error())
+	}
+}
+
+// formatEventStart formats the start of an event, with the weekday if it isn't today
+func formatEventStart(start time.Time) string {
+	if start.Before(time.Now()) {
+		return "now"
+	}
+
+	year, month, day := time.Now().In(start.Location()).Date()
+	if startYear, startMonth, startDay := start.Date(); startYear != year || startMonth != month || startDay != day {
+		return start.Format("Mon 15:04")
+	}
+	return start.Format("15:04")
+}
+
+// formatDate formats a time with a Go layout or strftime format
+func formatDate(format string, t time.Time) string {
+	var text string
+	if strings.Contains(format, "%") {
+		text = util.Strftime(format, t)
+	} else {
+		text = t.Format(format)
+	}
+
+	_, week := t.ISOWeek()
+	return strings.ReplaceAll(text, "{week}", fmt.Sprintf("%02d", week))
+}
+
+// zoneName returns the city of a time zone, e.g. New York for America/New_York
+func zoneName(zone *time.Location) string {
+	name := zone.String()
+	if idx := strings.LastIndex(name, "/"); idx != -1 {
+		name = name[idx+1:]
+	}
+	return strings.ReplaceAll(name, "_", " ")
+}
@@ -0,0 +1,138 @@
+package widget
+
+import (
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestFormatDate(t *testing.T) {
+	// a monday in the first ISO week of the next year
+	monday := time.Date(2024, 12, 30, 9, 5, 7, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"Mon 02-01-06 15:04", "Mon 30-12-24 09:05"},
+		{"Monday 2 January 2006 15:04:05 W{week}", "Monday 30 December 2024 09:05:07 W01"},
+		// strftime when there is a %
+		{"%a %d.%m %H:%M", "Mon 30.12 09:05"},
+		{"%G-W{week}", "2025-W01"},
+	}
+
+	for _, test := range tests {
+		if got := formatDate(test.format, monday); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestZoneName(t *testing.T) {
+	for name, want := range map[string]string{
+		"America/New_York":               "New York",
+		"America/Argentina/Buenos_Aires": "Buenos Aires",
+		"UTC":                            "UTC",
+	} {
+		zone, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := zoneName(zone); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+// newTestDate returns a date widget showing only the zone abbreviation, or
+// the offset in the long format, so the text doesn't change while testing
+func newTestDate(t *testing.T) (*Widget, *Date) {
+	widget := NewDateWidget(DateConfig{
+		Format:     "MST",
+		LongFormat: "-0700",
+		TimeZone:   "Europe/Oslo",
+		Zones:      []string{"America/New_York", "Asia/Kolkata", "Invalid/Zone"},
+	})
+	date := widget.impl.(*Date)
+	date.setup()
+	drainUpdates(t, widget)
+	return widget, date
+}
+
+func TestDateZones(t *testing.T) {
+	widget, date := newTestDate(t)
+
+	zoneText := func(name string, format string) string {
+		zone, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Now().In(zone).Format(format)
+	}
+
+	widget.Update()
+	// the configured zone is shown without its name
+	if want := zoneText("Europe/Oslo", "MST"); widget.block.FullText != want {
+		t.Errorf("got %q, want %q", widget.block.FullText, want)
+	}
+
+	// the invalid zone is skipped, and scrolling wraps around
+	tests := []struct {
+		btn  int
+		want string
+	}{
+		{4, zoneText("America/New_York", "MST") + " New York"},
+		{4, "IST Kolkata"},
+		{4, zoneText("Europe/Oslo", "MST")},
+		{5, "IST Kolkata"},
+		// left click toggles the long format
+		{1, "+0530 Kolkata"},
+		{5, zoneText("America/New_York", "-0700") + " New York"},
+		{1, zoneText("America/New_York", "MST") + " New York"},
+		// other buttons don't change anything
+		{2, zoneText("America/New_York", "MST") + " New York"},
+	}
+
+	for _, test := range tests {
+		date.onClick(0, 0, test.btn)
+		widget.Update()
+		if widget.block.FullText != test.want {
+			t.Errorf("button %d: got %q, want %q", test.btn, widget.block.FullText, test.want)
+		}
+	}
+}
+
+func TestDateClickWhileUpdating(t *testing.T) {
+	widget, date := newTestDate(t)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			date.onClick(0, 0, 4+i%2)
+			date.onClick(0, 0, 1)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		widget.Update()
+	}
+	wg.Wait()
+}
+
+func TestDateEventWhileUpdating(t *testing.T) {
+	widget, date := newTestDate(t)
+	date.config.Calendars = []string{"testdata/calendar.ics"}
+
+	queue := make(chan []*Update, 1)
+	widget.queue = queue
+	// keeps rereading the calendar after the test
+	go date.run()
+
+	for i := 0; i < 100; i++ {
+		widget.Update()
+	}
+	<-queue
+}
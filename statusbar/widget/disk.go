@@ -0,0 +1,201 @@
+package widget
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+const DISKSTATSFILE = "/proc/diskstats"
+
+// diskstats always counts 512 byte sectors, regardless of the device
+const SECTOR_SIZE = 512
+
+// nf-md-harddisk
+const ICON_DISK = '󰋊'
+
+type DiskConfig struct {
+	// MountPoints to show, defaults to / and /home. mount points on the same
+	// filesystem are only shown once
+	MountPoints []string
+	// ShowFree shows free space instead of used/total
+	ShowFree bool
+
+	// percentages of used space at or above which the widget is colored and set urgent
+	WarningThreshold int
+	UrgentThreshold  int
+
+	// Throughput shows read and write rates of all disks instead of usage
+	Throughput bool
+}
+
+type Disk struct {
+	*Widget
+	config DiskConfig
+
+	diskstatsFile *os.File
+	prevRead      int
+	prevWritten   int
+	prevTime      time.Time
+}
+
+func NewDiskWidget(config DiskConfig) *Widget {
+	if len(config.MountPoints) == 0 {
+		config.MountPoints = []string{"/", "/home"}
+	}
+	if config.WarningThreshold == 0 {
+		config.WarningThreshold = 85
+	}
+	if config.UrgentThreshold == 0 {
+		config.UrgentThreshold = 95
+	}
+
+	interval := 30000
+	if config.Throughput {
+		interval = 4000
+	}
+
+	return newWidget("disk", interval, func(widget *Widget) impl {
+		return &Disk{
+			Widget:      widget,
+			config:      config,
+			prevRead:    -1,
+			prevWritten: -1,
+		}
+	})
+}
+
+func (d *Disk) setup() {
+	if !d.config.Throughput {
+		return
+	}
+
+	if diskstatsFile, err := os.Open(DISKSTATSFILE); err != nil {
+		log.Fatalf("failed to open %s: %s", DISKSTATSFILE, err.Error())
+	} else {
+		d.diskstatsFile = diskstatsFile
+	}
+}
+
+func (d *Disk) close() {
+	if d.diskstatsFile != nil {
+		d.diskstatsFile.Close()
+	}
+}
+
+func (d *Disk) run() {}
+
+func (d *Disk) update(block *block) {
+	if d.config.Throughput {
+		d.updateThroughput(block)
+	} else {
+		d.updateUsage(block)
+	}
+}
+
+func (d *Disk) onClick(x int, y int, btn int) {}
+
+func (d *Disk) updateUsage(block *block) {
+	parts := make([]string, 0, len(d.config.MountPoints))
+	seen := make(map[syscall.Fsid]bool)
+	maxPercent := 0.0
+
+	for _, mountPoint := range d.config.MountPoints {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mountPoint, &stat); err != nil {
+			log.Printf("failed to statfs %s: %s", mountPoint, err.Error())
+			continue
+		}
+
+		// e.g. /home is often not a separate filesystem
+		if seen[stat.Fsid] {
+			continue
+		}
+		seen[stat.Fsid] = true
+
+		total := float64(stat.Blocks) * float64(stat.Bsize)
+		free := float64(stat.Bavail) * float64(stat.Bsize)
+		used := total - float64(stat.Bfree)*float64(stat.Bsize)
+
+		// percentage of the space available to users, like df
+		if used+free > 0 {
+			if percent := 100 * used / (used + free); percent > maxPercent {
+				maxPercent = percent
+			}
+		}
+
+		if d.config.ShowFree {
+			parts = append(parts, fmt.Sprintf("%s %s", mountPoint, util.FormatBytes(free)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s/%s", mountPoint, util.FormatBytes(used), util.FormatBytes(total)))
+		}
+	}
+
+	block.FullText = fmt.Sprintf("%c %s", ICON_DISK, strings.Join(parts, " "))
+	block.Urgent = maxPercent >= float64(d.config.UrgentThreshold)
+	if maxPercent >= float64(d.config.WarningThreshold) {
+		block.Color = COLOR_WARNING
+	} else {
+		block.Color = ""
+	}
+}
+
+func (d *Disk) updateThroughput(block *block) {
+	read, written := d.readDiskstats()
+	now := time.Now()
+
+	readRate := 0.0
+	writeRate := 0.0
+	if d.prevRead != -1 {
+		elapsed := now.Sub(d.prevTime).Seconds()
+		readRate = float64((read-d.prevRead)*SECTOR_SIZE) / elapsed
+		writeRate = float64((written-d.prevWritten)*SECTOR_SIZE) / elapsed
+	}
+
+	d.prevRead = read
+	d.prevWritten = written
+	d.prevTime = now
+
+	block.MinWidth = fmt.Sprintf("%c R 000.0K/s W 000.0K/s", ICON_DISK)
+	block.FullText = fmt.Sprintf("%c R %s/s W %s/s", ICON_DISK, util.FormatBytes(readRate), util.FormatBytes(writeRate))
+}
+
+// readDiskstats returns the total sectors read and written by all whole disks
+func (d *Disk) readDiskstats() (int, int) {
+	d.diskstatsFile.Seek(0, io.SeekStart)
+	scanner := bufio.NewScanner(d.diskstatsFile)
+
+	read := 0
+	written := 0
+	for scanner.Scan() {
+		// major minor name reads merged sectors_read ms writes merged sectors_written ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		// partitions and device mapper targets would count the same io twice
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "dm-") {
+			continue
+		}
+		if _, err := os.Stat("/sys/block/" + name); err != nil {
+			continue
+		}
+
+		sectorsRead, _ := strconv.Atoi(fields[5])
+		sectorsWritten, _ := strconv.Atoi(fields[9])
+		read += sectorsRead
+		written += sectorsWritten
+	}
+
+	return read, written
+}
@@ -6,23 +6,69 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
 const MEMFILE = "/proc/meminfo"
 
+type MemoryUnit int
+
+const (
+	MemoryGiB MemoryUnit = iota
+	MemoryMiB
+	MemoryPercent
+)
+
+type MemoryConfig struct {
+	// SysfsRoot is the mount point of sysfs, defaults to /sys
+	SysfsRoot string
+	// Unit used to show memory and swap, defaults to GiB
+	Unit MemoryUnit
+
+	// percentages of used memory at or above which the widget is colored and set urgent
+	WarningThreshold int
+	UrgentThreshold  int
+}
+
+// memoryData is the parsed content of /proc/meminfo, in kB
+type memoryData struct {
+	memTotal     int
+	memAvail     int
+	buffers      int
+	cached       int
+	sReclaimable int
+	swapTotal    int
+	swapFree     int
+}
+
 type Memory struct {
 	*Widget
-	memTotal int
-	memAvail int
-	memFile  *os.File
+	config  MemoryConfig
+	memFile *os.File
+	data    memoryData
+
+	// toggled by clicking, shows swap, cache and zram
+	detailed   bool
+	topProcess topProcessView
 }
 
-func NewMemoryWidget() *Widget {
+func NewMemoryWidget(config MemoryConfig) *Widget {
+	if config.SysfsRoot == "" {
+		config.SysfsRoot = "/sys"
+	}
+	if config.WarningThreshold == 0 {
+		config.WarningThreshold = 80
+	}
+	if config.UrgentThreshold == 0 {
+		config.UrgentThreshold = 95
+	}
+
 	return newWidget("memory", 4000, func(widget *Widget) impl {
 		return &Memory{
 			Widget: widget,
+			config: config,
 		}
 	})
 }
@@ -43,30 +89,153 @@ func (m *Memory) run() {}
 
 func (m *Memory) update(block *block) {
 	m.readMemoryData()
-	memTotalGb := float64(m.memTotal) / (1024 * 1024)
-	memUsedGb := float64(m.memTotal-m.memAvail) / (1024 * 1024)
+	data := &m.data
+
+	memUsed := data.memTotal - data.memAvail
+	block.FullText = "MEM " + m.formatUsage(memUsed, data.memTotal)
+	// reserve space for the widest value to avoid the bar jittering
+	block.MinWidth = "MEM " + m.formatUsage(data.memTotal, data.memTotal)
+
+	if m.topProcess.active() {
+		block.FullText = "MEM " + m.topProcess.text
+	} else if m.detailed {
+		cache := data.buffers + data.cached + data.sReclaimable
+		block.FullText += fmt.Sprintf(" CACHE %s", m.formatSize(cache))
+
+		if data.swapTotal > 0 {
+			block.FullText += " SWP " + m.formatUsage(data.swapTotal-data.swapFree, data.swapTotal)
+		}
+
+		if ratio, err := m.readZramRatio(); err == nil {
+			block.FullText += fmt.Sprintf(" ZRAM %.1fx", ratio)
+		}
+		block.MinWidth = ""
+	}
+
+	percent := 0
+	if data.memTotal > 0 {
+		percent = 100 * memUsed / data.memTotal
+	}
+
+	block.Urgent = percent >= m.config.UrgentThreshold
+	if percent >= m.config.WarningThreshold {
+		block.Color = COLOR_WARNING
+	} else {
+		block.Color = ""
+	}
+}
+
+// left click toggles between the summary and detailed view,
+// right click shows the process using the most memory
+func (m *Memory) onClick(x int, y int, btn int) {
+	if btn == 1 {
+		m.block.Lock()
+		m.detailed = !m.detailed
+		m.block.Unlock()
+		m.sendUpdate()
+	} else if btn == 3 {
+		// the data is written by update, which holds the block lock
+		m.block.Lock()
+		memTotal := m.data.memTotal
+		m.block.Unlock()
 
-	block.MinWidth = "00.0/00GiB"
-	block.FullText = fmt.Sprintf("MEM %.1f/%.0fGiB", memUsedGb, memTotalGb)
+		go func() {
+			if top, err := topMemoryProcess(memTotal); err != nil {
+				log.Printf("failed to find top process: %s", err.Error())
+			} else {
+				m.showTopProcess(&m.topProcess, top.String())
+			}
+		}()
+	}
 }
 
-func (c *Memory) onClick(x int, y int, btn int) {}
+// formatUsage formats used and total kB in the configured unit
+func (m *Memory) formatUsage(used int, total int) string {
+	switch m.config.Unit {
+	case MemoryMiB:
+		return fmt.Sprintf("%d/%dMiB", used/1024, total/1024)
+	case MemoryPercent:
+		if total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%d%%", 100*used/total)
+	default:
+		return fmt.Sprintf("%.1f/%.0fGiB", float64(used)/(1024*1024), float64(total)/(1024*1024))
+	}
+}
+
+// formatSize formats kB in the configured unit, percentages are of total memory
+func (m *Memory) formatSize(size int) string {
+	switch m.config.Unit {
+	case MemoryMiB:
+		return fmt.Sprintf("%dMiB", size/1024)
+	case MemoryPercent:
+		if m.data.memTotal == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%d%%", 100*size/m.data.memTotal)
+	default:
+		return fmt.Sprintf("%.1fGiB", float64(size)/(1024*1024))
+	}
+}
+
+// readZramRatio returns the compression ratio of all zram devices
+func (m *Memory) readZramRatio() (float64, error) {
+	files, _ := filepath.Glob(filepath.Join(m.config.SysfsRoot, "block/zram*/mm_stat"))
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no zram devices")
+	}
+
+	var orig, used float64
+	for _, file := range files {
+		// orig_data_size compr_data_size mem_used_total ...
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+
+		fields := strings.Fields(string(data))
+		if len(fields) < 3 {
+			continue
+		}
+
+		o, _ := strconv.ParseFloat(fields[0], 64)
+		u, _ := strconv.ParseFloat(fields[2], 64)
+		orig += o
+		used += u
+	}
+
+	if used == 0 {
+		return 0, fmt.Errorf("zram is unused")
+	}
+	return orig / used, nil
+}
 
 func (m *Memory) readMemoryData() {
 	m.memFile.Seek(0, io.SeekStart)
 	scanner := bufio.NewScanner(m.memFile)
 
-	m.memTotal = -1
-	m.memAvail = -1
-
-	for scanner.Scan() && (m.memTotal == -1 || m.memAvail == -1) {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "MemTotal") {
-			value := strings.Fields(line)[1]
-			m.memTotal, _ = strconv.Atoi(value)
-		} else if strings.HasPrefix(line, "MemAvailable") {
-			value := strings.Fields(line)[1]
-			m.memAvail, _ = strconv.Atoi(value)
+	fields := map[string]*int{
+		"MemTotal":     &m.data.memTotal,
+		"MemAvailable": &m.data.memAvail,
+		"Buffers":      &m.data.buffers,
+		"Cached":       &m.data.cached,
+		"SReclaimable": &m.data.sReclaimable,
+		"SwapTotal":    &m.data.swapTotal,
+		"SwapFree":     &m.data.swapFree,
+	}
+
+	found := 0
+	for scanner.Scan() && found < len(fields) {
+		// e.g. MemTotal:       16283260 kB
+		line := strings.Fields(scanner.Text())
+		if len(line) < 2 {
+			continue
+		}
+
+		if field, exists := fields[strings.TrimSuffix(line[0], ":")]; exists {
+			*field, _ = strconv.Atoi(line[1])
+			found++
 		}
 	}
 }
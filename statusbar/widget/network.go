@@ -1,13 +1,13 @@
 package widget
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/godbus/dbus/v5"
+	"github.com/haakonleg/statusbar-sway/util"
 )
 
 // nf-md-wifi
@@ -19,6 +19,36 @@ const ICON_WIFI_1 = '󰤟'
 // nf-md-ethernet
 const ICON_ETHERNET = '󰈀'
 
+// nf-md-lock
+const ICON_LOCK = '󰌾'
+
+// changes arriving within this duration of each other cause a single refresh
+const NETWORK_DEBOUNCE = 250 * time.Millisecond
+
+// number of throughput samples shown in the sparkline
+const SPARKLINE_LENGTH = 8
+
+type NetworkConfig struct {
+	// Throughput shows download and upload rates of the primary connection
+	Throughput bool
+	// Sparkline also shows recent total throughput, requires Throughput
+	Sparkline bool
+	// ThroughputInterval is how often rates are sampled in milliseconds, defaults to 2000
+	ThroughputInterval int
+
+	// formats of the primary connection. {icon}, {ifname}, {ip} and {ip6} are always
+	// available, {ssid}, {signal} and {bitrate} for wifi and {speed} for ethernet
+	WifiFormat     string
+	EthernetFormat string
+
+	// wifi signal strength in percent below which the widget is colored
+	WeakSignalThreshold int
+
+	// Launcher is the dmenu style command used to pick a wifi network,
+	// defaults to wofi --dmenu
+	Launcher []string
+}
+
 type netType int
 
 const (
@@ -27,9 +57,38 @@ const (
 	typeUnknown
 )
 
-type networkManagerInfoResult struct {
+// networkInfo is the state of the network connections
+type networkInfo struct {
 	connections       []*netConnection
 	primaryConnection *netConnection
+
+	// names of active vpn, wireguard and tun connections
+	vpns []string
+}
+
+// wifiBackend is implemented by backends that can connect to access points
+type wifiBackend interface {
+	accessPoints() ([]*accessPoint, error)
+	connect(ap *accessPoint) error
+}
+
+type accessPoint struct {
+	path     dbus.ObjectPath
+	device   dbus.ObjectPath
+	ssid     string
+	strength uint8
+	secured  bool
+}
+
+// networkBackend is the source of the network state
+type networkBackend interface {
+	// setup fails if the backend isn't available on this system
+	setup() error
+	close()
+	// run sends the network state on the channel whenever it may have changed
+	run(infoChannel chan<- *networkInfo)
+	// statistics samples the byte counters of a connection
+	statistics(connection *netConnection) (*netStatistics, error)
 }
 
 type ethernetData struct {
@@ -43,276 +102,335 @@ type wifiData struct {
 }
 
 type netConnection struct {
+	// only set by the NetworkManager backend
+	device  dbus.ObjectPath
 	ifName  string
+	ip4     string
+	ip6     string
 	netType netType
+	data    any
+}
+
+// netStatistics is a sample of the byte counters of an interface
+type netStatistics struct {
+	ifName  string
+	time    time.Time
 	rxBytes uint64
 	txBytes uint64
-	data    any
 }
 
 type Network struct {
 	*Widget
-	dbus              *dbus.Conn
+	config            NetworkConfig
+	backend           networkBackend
 	connections       []*netConnection
 	primaryConnection *netConnection
+	vpns              []string
 
-	nmInfoChannel   chan *networkManagerInfoResult
-	nmSignalChannel chan *dbus.Signal
+	// throughput of the primary connection in bytes per second
+	prevStatistics *netStatistics
+	rxRate         float64
+	txRate         float64
+	rateHistory    []float64
+
+	infoChannel       chan *networkInfo
+	statisticsChannel chan *netStatistics
 }
 
-func NewNetworkWidget() *Widget {
+func NewNetworkWidget(config NetworkConfig) *Widget {
+	if config.ThroughputInterval == 0 {
+		config.ThroughputInterval = 2000
+	}
+	if config.WifiFormat == "" {
+		config.WifiFormat = "{icon} {ifname} ({ssid})"
+	}
+	if config.EthernetFormat == "" {
+		config.EthernetFormat = "{icon} {ifname}"
+	}
+	if config.WeakSignalThreshold == 0 {
+		config.WeakSignalThreshold = 30
+	}
+	if len(config.Launcher) == 0 {
+		config.Launcher = []string{"wofi", "--dmenu", "--prompt", "Wi-Fi"}
+	}
+
 	return newWidget("network", -1, func(widget *Widget) impl {
 		return &Network{
-			Widget:          widget,
-			nmInfoChannel:   make(chan *networkManagerInfoResult, 1),
-			nmSignalChannel: make(chan *dbus.Signal, 10),
+			Widget:            widget,
+			config:            config,
+			rateHistory:       make([]float64, 0, SPARKLINE_LENGTH),
+			infoChannel:       make(chan *networkInfo, 1),
+			statisticsChannel: make(chan *netStatistics, 1),
 		}
 	})
 }
 
 func (n *Network) setup() {
-	// setup dbus
-	conn, err := dbus.ConnectSystemBus()
-	if err != nil {
-		log.Fatalf("failed to connect to dbus: %s", err.Error())
-	}
-
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath("/org/freedesktop/NetworkManager"),
-	); err != nil {
-		log.Fatalf(err.Error())
+	nm := newNmBackend(n.config)
+	err := nm.setup()
+	if err == nil {
+		n.backend = nm
+		return
 	}
 
-	// subscribe to dbus signals
-	conn.Signal(n.nmSignalChannel)
+	log.Printf("NetworkManager not available, falling back to /proc: %s", err.Error())
 
-	n.dbus = conn
+	proc := newProcBackend()
+	if err := proc.setup(); err != nil {
+		// still works, but only picks up changes by polling
+		log.Printf("failed to subscribe to rtnetlink: %s", err.Error())
+	}
+	n.backend = proc
 }
 
 func (n *Network) close() {
-	n.dbus.Close()
+	n.backend.close()
 }
 
-// listen for dbus signals and info update
+// listen for info and statistics updates
 func (n *Network) run() {
-	go n.updateNetworkManagerInfo()
+	go n.backend.run(n.infoChannel)
+
+	// a nil channel never fires, so statistics are only sampled when needed
+	var statisticsUpdate <-chan time.Time
+	if n.config.Throughput {
+		statisticsUpdate = time.NewTicker(time.Duration(n.config.ThroughputInterval) * time.Millisecond).C
+	}
 
-	infoUpdate := time.NewTicker(30 * time.Second)
 	for {
 		select {
-		case info := <-n.nmInfoChannel:
+		case info := <-n.infoChannel:
+			n.block.Lock()
 			n.connections = info.connections
 			n.primaryConnection = info.primaryConnection
+			n.vpns = info.vpns
+			n.block.Unlock()
 
 			// trigger immediate update
 			n.sendUpdate()
 
-		case sig := <-n.nmSignalChannel:
-			log.Printf("signal: %+v", sig)
+		case statistics := <-n.statisticsChannel:
+			n.block.Lock()
+			n.updateRates(statistics)
+			n.block.Unlock()
+			n.sendUpdate()
 
-		case <-infoUpdate.C:
-			log.Println("updating network manager info")
-			go n.updateNetworkManagerInfo()
+		case <-statisticsUpdate:
+			if n.primaryConnection != nil {
+				go n.updateStatistics(n.primaryConnection)
+			}
 		}
 	}
 }
 
+// updateStatistics samples the byte counters of a connection
+func (n *Network) updateStatistics(connection *netConnection) {
+	if statistics, err := n.backend.statistics(connection); err != nil {
+		log.Printf("failed to get network statistics: %s", err.Error())
+	} else {
+		n.statisticsChannel <- statistics
+	}
+}
+
 func (n *Network) update(block *block) {
-	if n.connections != nil && len(n.connections) > 0 {
+	if n.connections != nil && len(n.connections) > 0 && n.primaryConnection != nil {
 		primary := n.primaryConnection
+		block.Color = ""
 
 		if primary.netType == typeWifi {
 			info := primary.data.(*wifiData)
-			block.FullText = fmt.Sprintf("%c %s (%s)", ICON_WIFI_2, primary.ifName, info.ssid)
+
+			format := n.config.WifiFormat
+			if info.ssid == "" && strings.Contains(format, "{ssid}") {
+				// the fallback backend can't read the ssid
+				format = "{icon} {ifname}"
+			}
+
+			block.FullText = formatConnection(format, primary)
+			if int(info.signalQuality) < n.config.WeakSignalThreshold {
+				block.Color = COLOR_WARNING
+			}
 		} else if primary.netType == typeEthernet {
-			block.FullText = fmt.Sprintf("%c %s", ICON_ETHERNET, primary.ifName)
+			block.FullText = formatConnection(n.config.EthernetFormat, primary)
+		} else {
+			block.FullText = primary.ifName
+		}
+
+		if len(n.vpns) > 0 {
+			block.FullText += fmt.Sprintf(" %c %s", ICON_LOCK, strings.Join(n.vpns, ", "))
+		}
+
+		block.MinWidth = ""
+		if n.config.Throughput {
+			// reserve space for the widest rates to avoid the bar jittering,
+			// padding with spaces doesn't work with proportional fonts
+			block.MinWidth = block.FullText + " " + n.formatRates("000.0K", "000.0K")
+			block.FullText += " " + n.formatRates(util.FormatBytes(n.rxRate), util.FormatBytes(n.txRate))
 		}
 	} else {
 		block.FullText = "No connection"
+		block.MinWidth = ""
 	}
 }
 
-func (c *Network) onClick(x int, y int, btn int) {}
-
-func (n *Network) updateNetworkManagerInfo() {
-	result := &networkManagerInfoResult{}
-
-	var props map[string]interface{}
-	if err := n.nmDbusCall(&props, "/org/freedesktop/NetworkManager", ""); err != nil {
+// pickWifi lets the user choose an access point in the launcher and connects to it
+func (n *Network) pickWifi(wifi wifiBackend) {
+	aps, err := wifi.accessPoints()
+	if err != nil {
+		log.Printf("failed to get access points: %s", err.Error())
+		return
+	} else if len(aps) == 0 {
 		return
 	}
 
-	primaryConnection := props["PrimaryConnection"].(dbus.ObjectPath)
-	devices := props["Devices"].([]dbus.ObjectPath)
-
-	// get active connections
-	connections := make([]*netConnection, 0)
-	for _, device := range devices {
-		if err := n.nmDbusCall(&props, device, ".Device"); err != nil {
-			continue
-		}
-
-		activeConnection := props["ActiveConnection"].(dbus.ObjectPath)
-		if activeConnection == "/" {
-			continue
+	options := make([]string, len(aps))
+	for idx, ap := range aps {
+		options[idx] = fmt.Sprintf("%c %s %d%%", wifiIcon(ap.strength), ap.ssid, ap.strength)
+		if ap.secured {
+			options[idx] += fmt.Sprintf(" %c", ICON_LOCK)
 		}
+	}
 
-		connection := &netConnection{
-			ifName:  props["Interface"].(string),
-			netType: typeUnknown,
-		}
+	choice, err := util.RunLauncher(n.config.Launcher, options)
+	if err != nil {
+		// also happens when the launcher is dismissed
+		log.Printf("no access point chosen: %s", err.Error())
+		return
+	}
 
-		if activeConnection == primaryConnection {
-			result.primaryConnection = connection
+	for idx, option := range options {
+		if option == choice {
+			if err := wifi.connect(aps[idx]); err != nil {
+				log.Printf("failed to connect to %s: %s", aps[idx].ssid, err.Error())
+			}
+			return
 		}
+	}
+}
 
-		typeNum := props["DeviceType"].(uint32)
-		if typeNum == 1 {
-			// NM_DEVICE_TYPE_ETHERNET
-			connection.netType = typeEthernet
-			ethernetInfo := &ethernetData{}
+// formatConnection replaces the placeholders in format with connection details
+func formatConnection(format string, connection *netConnection) string {
+	replacements := []string{
+		"{ifname}", connection.ifName,
+		"{ip}", connection.ip4,
+		"{ip6}", connection.ip6,
+	}
 
-			if err := n.nmDbusCall(&props, device, ".Device.Wired"); err == nil {
-				ethernetInfo.speed = props["Speed"].(uint32)
-			}
+	switch data := connection.data.(type) {
+	case *wifiData:
+		replacements = append(replacements,
+			"{icon}", string(wifiIcon(data.signalQuality)),
+			"{ssid}", data.ssid,
+			"{signal}", fmt.Sprintf("%d%%", data.signalQuality),
+			// in kbit/s
+			"{bitrate}", fmt.Sprintf("%dMb/s", data.bitrate/1000),
+		)
+	case *ethernetData:
+		replacements = append(replacements,
+			"{icon}", string(ICON_ETHERNET),
+			// in Mbit/s
+			"{speed}", fmt.Sprintf("%dMb/s", data.speed),
+		)
+	}
 
-			connection.data = ethernetInfo
-		} else if typeNum == 2 {
-			// NM_DEVICE_TYPE_WIFI
-			connection.netType = typeWifi
-			wifiInfo := &wifiData{}
-			var accessPoint dbus.ObjectPath
+	return strings.NewReplacer(replacements...).Replace(format)
+}
 
-			if err := n.nmDbusCall(&props, device, ".Device.Wireless"); err == nil {
+// wifiIcon returns the icon for a signal strength in percent
+func wifiIcon(signalQuality uint8) rune {
+	if signalQuality >= 75 {
+		return ICON_WIFI_4
+	} else if signalQuality >= 50 {
+		return ICON_WIFI_3
+	} else if signalQuality >= 25 {
+		return ICON_WIFI_2
+	}
+	return ICON_WIFI_1
+}
 
-				wifiInfo.bitrate = props["Bitrate"].(uint32)
-				accessPoint = props["ActiveAccessPoint"].(dbus.ObjectPath)
-			}
+// formatRates formats the download and upload rates, followed by the sparkline
+func (n *Network) formatRates(rx string, tx string) string {
+	text := fmt.Sprintf("⇣%s/s ⇡%s/s", rx, tx)
 
-			// get access point
-			if accessPoint.IsValid() {
-				if err := n.nmDbusCall(&props, accessPoint, ".AccessPoint"); err == nil {
-					ssid := props["Ssid"].([]uint8)
-					wifiInfo.ssid = string(ssid)
-					wifiInfo.signalQuality = props["Strength"].(uint8)
-				}
+	if n.config.Sparkline && len(n.rateHistory) > 0 {
+		max := 0.0
+		for _, rate := range n.rateHistory {
+			if rate > max {
+				max = rate
 			}
-
-			connection.data = wifiInfo
 		}
 
-		// get statistics
-		if err := n.nmDbusCall(&props, device, ".Device.Statistics"); err == nil {
-			connection.rxBytes = props["RxBytes"].(uint64)
-			connection.txBytes = props["TxBytes"].(uint64)
+		var sb strings.Builder
+		for _, rate := range n.rateHistory {
+			level := 0
+			if max > 0 {
+				level = int(rate / max * float64(len(CPU_BARS)-1))
+			}
+			sb.WriteRune(CPU_BARS[level])
 		}
-
-		connections = append(connections, connection)
+		text += " " + sb.String()
 	}
 
-	result.connections = connections
-	n.nmInfoChannel <- result
+	return text
 }
 
-func (n *Network) nmDbusCall(result interface{}, object dbus.ObjectPath, ifname string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
-	defer cancel()
-
-	resultCh := make(chan *dbus.Call, 1)
-	bus := n.dbus.Object("org.freedesktop.NetworkManager", object)
-	bus.GoWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, resultCh, "org.freedesktop.NetworkManager"+ifname)
+// updateRates calculates the throughput since the previous sample
+func (n *Network) updateRates(statistics *netStatistics) {
+	prev := n.prevStatistics
+	n.prevStatistics = statistics
 
-	select {
-	case <-ctx.Done():
-		log.Printf("failed to call NetworkManager: timeout")
-		return errors.New("timeout")
-
-	case call := <-resultCh:
-		if call.Err != nil {
-			log.Printf("failed to call NetworkManager: %s", call.Err.Error())
-			return call.Err
-		} else {
-			call.Store(result)
-			return nil
-		}
+	// counters are per device, and reset when a device reappears
+	if prev == nil || prev.ifName != statistics.ifName ||
+		statistics.rxBytes < prev.rxBytes || statistics.txBytes < prev.txBytes {
+		n.rxRate = 0
+		n.txRate = 0
+		return
 	}
-}
-
-/*
-func (n *Network) readNetworkData() {
-	n.numInterfaces = 0
-
-	// get interfaces
-	n.netDevFile.Seek(0, io.SeekStart)
-	scanner := bufio.NewScanner(n.netDevFile)
 
-	scanner.Scan()
-	scanner.Scan()
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	elapsed := statistics.time.Sub(prev.time).Seconds()
+	if elapsed <= 0 {
+		return
+	}
 
-		// skip loopback interface
-		if strings.HasPrefix(line, "lo") {
-			continue
-		}
+	n.rxRate = float64(statistics.rxBytes-prev.rxBytes) / elapsed
+	n.txRate = float64(statistics.txBytes-prev.txBytes) / elapsed
 
-		fields := strings.Fields(line)
-		if len(fields) > 1 {
-			if len(n.netInterfaces) < n.numInterfaces+1 {
-				n.netInterfaces = append(n.netInterfaces, &netInterface{})
-			}
+	if len(n.rateHistory) == SPARKLINE_LENGTH {
+		n.rateHistory = n.rateHistory[1:]
+	}
+	n.rateHistory = append(n.rateHistory, n.rxRate+n.txRate)
+}
 
-			netInterface := n.netInterfaces[n.numInterfaces]
-			netInterface.name = fields[0][:len(fields[0])-1]
-			netInterface.isWireless = false
-			netInterface.signalQuality = 0
-			n.numInterfaces++
+// left click opens the wifi picker, right click copies the address of the
+// primary connection
+func (n *Network) onClick(x int, y int, btn int) {
+	if btn == 1 {
+		if wifi, ok := n.backend.(wifiBackend); ok {
+			go n.pickWifi(wifi)
 		}
+		return
 	}
 
-	n.netWirelessFile.Seek(0, io.SeekStart)
-	scanner = bufio.NewScanner(n.netWirelessFile)
-
-	scanner.Scan()
-	scanner.Scan()
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		for i := 0; i < n.numInterfaces; i++ {
-			netInterface := n.netInterfaces[i]
-			if !strings.HasPrefix(line, netInterface.name) {
-				continue
-			}
-
-			fields := strings.Fields(line)
-			if len(fields) > 1 {
-				netInterface.isWireless = true
+	if btn != 3 {
+		return
+	}
 
-				signalQuality := fields[4][:len(fields[4])-1]
-				netInterface.signalQuality, _ = strconv.Atoi(signalQuality)
-			}
+	// the connection is replaced by run
+	n.block.Lock()
+	address := ""
+	if primary := n.primaryConnection; primary != nil {
+		address = primary.ip4
+		if address == "" {
+			address = primary.ip6
 		}
 	}
+	n.block.Unlock()
 
-	n.netRouteFile.Seek(0, io.SeekStart)
-	scanner = bufio.NewScanner(n.netRouteFile)
-
-	scanner.Scan()
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		for i := 0; i < n.numInterfaces; i++ {
-			netInterface := n.netInterfaces[i]
-			if !strings.HasPrefix(line, netInterface.name) {
-				continue
-			}
-
-			fields := strings.Fields(line)
-			destination := fields[1]
+	if address == "" {
+		return
+	}
 
-			if destination == "00000000" {
-			}
-		}
+	if err := util.CopyToClipboard(address); err != nil {
+		log.Printf("failed to copy address: %s", err.Error())
 	}
 }
-*/
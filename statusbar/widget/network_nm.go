@@ -0,0 +1,486 @@
+package widget
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const NM_PATH = "/org/freedesktop/NetworkManager"
+
+// refresh interval in case a signal was missed
+const NM_POLL_INTERVAL = 5 * time.Minute
+
+type nmInfoResult struct {
+	info *networkInfo
+
+	// all devices and active access points, which signals are subscribed from
+	objects []dbus.ObjectPath
+}
+
+// nmBackend gets the network state from NetworkManager over the system bus
+type nmBackend struct {
+	config NetworkConfig
+	dbus   *dbus.Conn
+
+	nmInfoChannel   chan *nmInfoResult
+	nmSignalChannel chan *dbus.Signal
+
+	// object paths signals are currently subscribed from
+	subscriptions map[dbus.ObjectPath]bool
+}
+
+func newNmBackend(config NetworkConfig) *nmBackend {
+	return &nmBackend{
+		config:          config,
+		nmInfoChannel:   make(chan *nmInfoResult, 1),
+		nmSignalChannel: make(chan *dbus.Signal, 10),
+		subscriptions:   make(map[dbus.ObjectPath]bool),
+	}
+}
+
+func (n *nmBackend) setup() error {
+	// setup dbus
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+
+	n.dbus = conn
+
+	// fail early if NetworkManager isn't running
+	var props map[string]interface{}
+	if err := n.nmDbusCall(&props, NM_PATH, ""); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// subscribe to dbus signals, devices and access points are subscribed
+	// to once they are known
+	if err := n.subscribe(NM_PATH); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.Signal(n.nmSignalChannel)
+
+	return nil
+}
+
+func (n *nmBackend) close() {
+	n.dbus.Close()
+}
+
+// listen for dbus signals and info update
+func (n *nmBackend) run(infoChannel chan<- *networkInfo) {
+	go n.updateNetworkManagerInfo()
+
+	infoUpdate := time.NewTicker(NM_POLL_INTERVAL)
+
+	// set while a refresh is pending after a signal
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case result := <-n.nmInfoChannel:
+			n.updateSubscriptions(result.objects)
+			infoChannel <- result.info
+
+		case sig := <-n.nmSignalChannel:
+			if debounce == nil && isStateSignal(sig) {
+				debounce = time.After(NETWORK_DEBOUNCE)
+			}
+
+		case <-debounce:
+			debounce = nil
+			go n.updateNetworkManagerInfo()
+
+		case <-infoUpdate.C:
+			log.Println("updating network manager info")
+			go n.updateNetworkManagerInfo()
+		}
+	}
+}
+
+// statistics samples the byte counters of a device
+func (n *nmBackend) statistics(connection *netConnection) (*netStatistics, error) {
+	var props map[string]interface{}
+	err := n.nmDbusCall(&props, connection.device, ".Device.Statistics")
+
+	// the kernel has the same counters when NetworkManager doesn't provide them
+	rxBytes, rxOk := props["RxBytes"].(uint64)
+	txBytes, txOk := props["TxBytes"].(uint64)
+	if err != nil || !rxOk || !txOk {
+		return readProcStatistics(connection.ifName)
+	}
+
+	return &netStatistics{
+		ifName:  connection.ifName,
+		time:    time.Now(),
+		rxBytes: rxBytes,
+		txBytes: txBytes,
+	}, nil
+}
+
+// subscribe adds a match rule for signals from a NetworkManager object
+func (n *nmBackend) subscribe(object dbus.ObjectPath) error {
+	if err := n.dbus.AddMatchSignal(
+		dbus.WithMatchSender("org.freedesktop.NetworkManager"),
+		dbus.WithMatchObjectPath(object),
+	); err != nil {
+		return err
+	}
+
+	n.subscriptions[object] = true
+	return nil
+}
+
+// updateSubscriptions subscribes to signals from new objects, and
+// unsubscribes from objects that are gone
+func (n *nmBackend) updateSubscriptions(objects []dbus.ObjectPath) {
+	current := map[dbus.ObjectPath]bool{NM_PATH: true}
+	for _, object := range objects {
+		current[object] = true
+
+		if !n.subscriptions[object] {
+			if err := n.subscribe(object); err != nil {
+				log.Printf("failed to subscribe to %s: %s", object, err.Error())
+			}
+		}
+	}
+
+	for object := range n.subscriptions {
+		if current[object] {
+			continue
+		}
+
+		if err := n.dbus.RemoveMatchSignal(
+			dbus.WithMatchSender("org.freedesktop.NetworkManager"),
+			dbus.WithMatchObjectPath(object),
+		); err != nil {
+			log.Printf("failed to unsubscribe from %s: %s", object, err.Error())
+		}
+		delete(n.subscriptions, object)
+	}
+}
+
+// isStateSignal returns true for signals that may change what is shown
+func isStateSignal(sig *dbus.Signal) bool {
+	switch sig.Name {
+	case "org.freedesktop.NetworkManager.StateChanged",
+		"org.freedesktop.NetworkManager.Device.StateChanged",
+		"org.freedesktop.NetworkManager.DeviceAdded",
+		"org.freedesktop.NetworkManager.DeviceRemoved":
+		return true
+
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		// statistics change every refresh interval, and are sampled separately
+		if len(sig.Body) > 0 {
+			iface, _ := sig.Body[0].(string)
+			return iface != "org.freedesktop.NetworkManager.Device.Statistics"
+		}
+	}
+
+	return false
+}
+
+func (n *nmBackend) updateNetworkManagerInfo() {
+	result := &networkInfo{}
+
+	var props map[string]interface{}
+	if err := n.nmDbusCall(&props, NM_PATH, ""); err != nil {
+		return
+	}
+
+	primaryConnection := props["PrimaryConnection"].(dbus.ObjectPath)
+	devices := props["Devices"].([]dbus.ObjectPath)
+	activeConnections := props["ActiveConnections"].([]dbus.ObjectPath)
+
+	// get vpn connections
+	result.vpns = make([]string, 0)
+	var primaryDevices []dbus.ObjectPath
+	for _, activeConnection := range activeConnections {
+		// replies are merged into the map, keys of the previous one would remain
+		props = nil
+		if err := n.nmDbusCall(&props, activeConnection, ".Connection.Active"); err != nil {
+			continue
+		}
+
+		// a vpn is attached to the device it is tunneled through
+		if activeConnection == primaryConnection {
+			primaryDevices, _ = props["Devices"].([]dbus.ObjectPath)
+		}
+
+		id, _ := props["Id"].(string)
+		connType, _ := props["Type"].(string)
+		isVpn, _ := props["Vpn"].(bool)
+		if id != "" && (isVpn || connType == "wireguard" || connType == "tun") {
+			result.vpns = append(result.vpns, id)
+		}
+	}
+
+	// get active connections
+	connections := make([]*netConnection, 0)
+	objects := make([]dbus.ObjectPath, 0, len(devices))
+	for _, device := range devices {
+		objects = append(objects, device)
+
+		props = nil
+		if err := n.nmDbusCall(&props, device, ".Device"); err != nil {
+			continue
+		}
+
+		activeConnection := props["ActiveConnection"].(dbus.ObjectPath)
+		if activeConnection == "/" {
+			continue
+		}
+
+		connection := &netConnection{
+			device:  device,
+			ifName:  props["Interface"].(string),
+			netType: typeUnknown,
+		}
+		ip4Config := props["Ip4Config"].(dbus.ObjectPath)
+		ip6Config := props["Ip6Config"].(dbus.ObjectPath)
+
+		if activeConnection == primaryConnection {
+			result.primaryConnection = connection
+		}
+
+		typeNum := props["DeviceType"].(uint32)
+		if typeNum == 1 {
+			// NM_DEVICE_TYPE_ETHERNET
+			connection.netType = typeEthernet
+			ethernetInfo := &ethernetData{}
+
+			if err := n.nmDbusCall(&props, device, ".Device.Wired"); err == nil {
+				ethernetInfo.speed = props["Speed"].(uint32)
+			}
+
+			connection.data = ethernetInfo
+		} else if typeNum == 2 {
+			// NM_DEVICE_TYPE_WIFI
+			connection.netType = typeWifi
+			wifiInfo := &wifiData{}
+			var accessPoint dbus.ObjectPath
+
+			if err := n.nmDbusCall(&props, device, ".Device.Wireless"); err == nil {
+
+				wifiInfo.bitrate = props["Bitrate"].(uint32)
+				accessPoint = props["ActiveAccessPoint"].(dbus.ObjectPath)
+			}
+
+			// get access point
+			if accessPoint.IsValid() && accessPoint != "/" {
+				// follow signal strength and roaming
+				objects = append(objects, accessPoint)
+
+				if err := n.nmDbusCall(&props, accessPoint, ".AccessPoint"); err == nil {
+					ssid := props["Ssid"].([]uint8)
+					wifiInfo.ssid = string(ssid)
+					wifiInfo.signalQuality = props["Strength"].(uint8)
+				}
+			}
+
+			connection.data = wifiInfo
+		}
+
+		// get first ipv4 and ipv6 address
+		if ip4Config != "/" {
+			if err := n.nmDbusCall(&props, ip4Config, ".IP4Config"); err == nil {
+				connection.ip4 = firstAddress(props["AddressData"])
+			}
+		}
+		if ip6Config != "/" {
+			if err := n.nmDbusCall(&props, ip6Config, ".IP6Config"); err == nil {
+				connection.ip6 = firstAddress(props["AddressData"])
+			}
+		}
+
+		// the counters are only updated while a refresh rate is set
+		if n.config.Throughput {
+			if err := n.nmDbusCall(&props, device, ".Device.Statistics"); err == nil {
+				if refreshRate, ok := props["RefreshRateMs"].(uint32); ok && refreshRate == 0 {
+					n.enableStatistics(device)
+				}
+			}
+		}
+
+		connections = append(connections, connection)
+	}
+
+	// the primary connection may be a vpn without a device of its own, use
+	// the device it goes through rather than any device, which may be lo
+	if result.primaryConnection == nil {
+		for _, connection := range connections {
+			for _, device := range primaryDevices {
+				if connection.device == device {
+					result.primaryConnection = connection
+				}
+			}
+		}
+	}
+
+	result.connections = connections
+	n.nmInfoChannel <- &nmInfoResult{info: result, objects: objects}
+}
+
+// firstAddress returns the first address in an IP4Config or IP6Config AddressData
+// property, link-local ipv6 addresses are skipped
+func firstAddress(addressData interface{}) string {
+	addresses, ok := addressData.([]map[string]dbus.Variant)
+	if !ok {
+		return ""
+	}
+
+	for _, data := range addresses {
+		address, _ := data["address"].Value().(string)
+		if address != "" && !strings.HasPrefix(address, "fe80:") {
+			return address
+		}
+	}
+	return ""
+}
+
+// enableStatistics sets the refresh rate of the byte counters of a device
+func (n *nmBackend) enableStatistics(device dbus.ObjectPath) {
+	bus := n.dbus.Object("org.freedesktop.NetworkManager", device)
+	call := bus.Call("org.freedesktop.DBus.Properties.Set", 0,
+		"org.freedesktop.NetworkManager.Device.Statistics", "RefreshRateMs",
+		dbus.MakeVariant(uint32(n.config.ThroughputInterval)))
+	if call.Err != nil {
+		log.Printf("failed to enable statistics for %s: %s", device, call.Err.Error())
+	}
+}
+
+func (n *nmBackend) nmDbusCall(result interface{}, object dbus.ObjectPath, ifname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	resultCh := make(chan *dbus.Call, 1)
+	bus := n.dbus.Object("org.freedesktop.NetworkManager", object)
+	bus.GoWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, resultCh, "org.freedesktop.NetworkManager"+ifname)
+
+	select {
+	case <-ctx.Done():
+		log.Printf("failed to call NetworkManager: timeout")
+		return errors.New("timeout")
+
+	case call := <-resultCh:
+		if call.Err != nil {
+			log.Printf("failed to call NetworkManager: %s", call.Err.Error())
+			return call.Err
+		} else {
+			call.Store(result)
+			return nil
+		}
+	}
+}
+
+// accessPoints returns the visible access points of all wifi devices, strongest first.
+// only the strongest access point of each ssid is kept
+func (n *nmBackend) accessPoints() ([]*accessPoint, error) {
+	var devices []dbus.ObjectPath
+	nm := n.dbus.Object("org.freedesktop.NetworkManager", NM_PATH)
+	if err := nm.Call("org.freedesktop.NetworkManager.GetDevices", 0).Store(&devices); err != nil {
+		return nil, err
+	}
+
+	bySsid := make(map[string]*accessPoint)
+	var props map[string]interface{}
+	for _, device := range devices {
+		if err := n.nmDbusCall(&props, device, ".Device"); err != nil || props["DeviceType"].(uint32) != 2 {
+			continue
+		}
+
+		var paths []dbus.ObjectPath
+		bus := n.dbus.Object("org.freedesktop.NetworkManager", device)
+		if err := bus.Call("org.freedesktop.NetworkManager.Device.Wireless.GetAllAccessPoints", 0).Store(&paths); err != nil {
+			log.Printf("failed to get access points: %s", err.Error())
+			continue
+		}
+
+		for _, path := range paths {
+			if err := n.nmDbusCall(&props, path, ".AccessPoint"); err != nil {
+				continue
+			}
+
+			ap := &accessPoint{
+				path:     path,
+				device:   device,
+				ssid:     string(props["Ssid"].([]uint8)),
+				strength: props["Strength"].(uint8),
+				// NM_802_11_AP_FLAGS_PRIVACY, or any wpa/rsn flags
+				secured: props["Flags"].(uint32)&0x1 != 0 || props["WpaFlags"].(uint32) != 0 || props["RsnFlags"].(uint32) != 0,
+			}
+
+			// hidden networks can't be picked by name
+			if ap.ssid == "" {
+				continue
+			}
+
+			if existing, exists := bySsid[ap.ssid]; !exists || ap.strength > existing.strength {
+				bySsid[ap.ssid] = ap
+			}
+		}
+	}
+
+	result := make([]*accessPoint, 0, len(bySsid))
+	for _, ap := range bySsid {
+		result = append(result, ap)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].strength > result[j].strength
+	})
+
+	return result, nil
+}
+
+// connect activates the saved connection for the ssid of the access point, or
+// creates a new one. secrets are asked for by the session's secret agent
+func (n *nmBackend) connect(ap *accessPoint) error {
+	nm := n.dbus.Object("org.freedesktop.NetworkManager", NM_PATH)
+
+	if connection, err := n.findConnection(ap.ssid); err != nil {
+		return err
+	} else if connection != "" {
+		log.Printf("activating saved connection %s for %s", connection, ap.ssid)
+		return nm.Call("org.freedesktop.NetworkManager.ActivateConnection", 0,
+			connection, ap.device, ap.path).Err
+	}
+
+	// NetworkManager fills in the rest of the settings from the access point
+	log.Printf("adding connection for %s", ap.ssid)
+	settings := map[string]map[string]dbus.Variant{}
+	return nm.Call("org.freedesktop.NetworkManager.AddAndActivateConnection", 0,
+		settings, ap.device, ap.path).Err
+}
+
+// findConnection returns the saved wifi connection with the ssid, if any
+func (n *nmBackend) findConnection(ssid string) (dbus.ObjectPath, error) {
+	var connections []dbus.ObjectPath
+	settings := n.dbus.Object("org.freedesktop.NetworkManager", NM_PATH+"/Settings")
+	if err := settings.Call("org.freedesktop.NetworkManager.Settings.ListConnections", 0).Store(&connections); err != nil {
+		return "", err
+	}
+
+	for _, connection := range connections {
+		var values map[string]map[string]dbus.Variant
+		bus := n.dbus.Object("org.freedesktop.NetworkManager", connection)
+		if err := bus.Call("org.freedesktop.NetworkManager.Settings.Connection.GetSettings", 0).Store(&values); err != nil {
+			continue
+		}
+
+		if wireless, exists := values["802-11-wireless"]; exists {
+			if connectionSsid, ok := wireless["ssid"].Value().([]byte); ok && string(connectionSsid) == ssid {
+				return connection, nil
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,359 @@
+package widget
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startPrivateBus runs a dbus-daemon for the test and returns its address
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(testBusConfig, filepath.Join(dir, "bus"))), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to start dbus-daemon: %s", err.Error())
+	}
+	return strings.TrimSpace(address)
+}
+
+func connectPrivateBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakeProperties answers GetAll for every interface of an object
+type fakeProperties map[string]dbus.Variant
+
+func (p fakeProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return p, nil
+}
+
+// fakeNetworkManager records the connections activated through it
+type fakeNetworkManager struct {
+	sync.Mutex
+	devices   []dbus.ObjectPath
+	activated []string
+}
+
+func (f *fakeNetworkManager) GetDevices() ([]dbus.ObjectPath, *dbus.Error) {
+	return f.devices, nil
+}
+
+func (f *fakeNetworkManager) ActivateConnection(connection, device, specific dbus.ObjectPath) (dbus.ObjectPath, *dbus.Error) {
+	f.Lock()
+	defer f.Unlock()
+	f.activated = append(f.activated, fmt.Sprintf("activate %s %s %s", connection, device, specific))
+	return NM_PATH + "/ActiveConnection/1", nil
+}
+
+func (f *fakeNetworkManager) AddAndActivateConnection(settings map[string]map[string]dbus.Variant, device, specific dbus.ObjectPath) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f.Lock()
+	defer f.Unlock()
+	f.activated = append(f.activated, fmt.Sprintf("add %s %s", device, specific))
+	return NM_PATH + "/Settings/3", NM_PATH + "/ActiveConnection/2", nil
+}
+
+type fakeWireless []dbus.ObjectPath
+
+func (f fakeWireless) GetAllAccessPoints() ([]dbus.ObjectPath, *dbus.Error) {
+	return f, nil
+}
+
+type fakeSettings []dbus.ObjectPath
+
+func (f fakeSettings) ListConnections() ([]dbus.ObjectPath, *dbus.Error) {
+	return f, nil
+}
+
+type fakeConnection map[string]map[string]dbus.Variant
+
+func (f fakeConnection) GetSettings() (map[string]map[string]dbus.Variant, *dbus.Error) {
+	return f, nil
+}
+
+// exportFakeNetworkManager serves a wifi device with four access points, an
+// ethernet device and a saved connection for the home network
+func exportFakeNetworkManager(t *testing.T, conn *dbus.Conn) *fakeNetworkManager {
+	t.Helper()
+
+	export := func(value interface{}, path dbus.ObjectPath, iface string) {
+		if err := conn.Export(value, path, iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wifi := dbus.ObjectPath(NM_PATH + "/Devices/1")
+	ethernet := dbus.ObjectPath(NM_PATH + "/Devices/2")
+	loopback := dbus.ObjectPath(NM_PATH + "/Devices/3")
+	nm := &fakeNetworkManager{devices: []dbus.ObjectPath{ethernet, wifi}}
+	export(nm, NM_PATH, "org.freedesktop.NetworkManager")
+	// the vpn is the primary connection, and lo has the lowest ifindex
+	export(fakeProperties{
+		"PrimaryConnection": dbus.MakeVariant(dbus.ObjectPath(NM_PATH + "/ActiveConnection/2")),
+		"Devices":           dbus.MakeVariant(append([]dbus.ObjectPath{loopback}, nm.devices...)),
+		"ActiveConnections": dbus.MakeVariant([]dbus.ObjectPath{
+			NM_PATH + "/ActiveConnection/1",
+			NM_PATH + "/ActiveConnection/2",
+			NM_PATH + "/ActiveConnection/3",
+			NM_PATH + "/ActiveConnection/4",
+		}),
+	}, NM_PATH, "org.freedesktop.DBus.Properties")
+
+	// the same properties are returned for every interface of a device, the
+	// Statistics interface is missing like on older NetworkManager versions
+	export(fakeProperties{
+		"DeviceType":        dbus.MakeVariant(uint32(2)),
+		"Interface":         dbus.MakeVariant("wlan0"),
+		"ActiveConnection":  dbus.MakeVariant(dbus.ObjectPath(NM_PATH + "/ActiveConnection/1")),
+		"Ip4Config":         dbus.MakeVariant(dbus.ObjectPath(NM_PATH + "/IP4Config/1")),
+		"Ip6Config":         dbus.MakeVariant(dbus.ObjectPath("/")),
+		"Bitrate":           dbus.MakeVariant(uint32(270000)),
+		"ActiveAccessPoint": dbus.MakeVariant(dbus.ObjectPath(NM_PATH + "/AccessPoint/2")),
+	}, wifi, "org.freedesktop.DBus.Properties")
+	export(fakeProperties{
+		"DeviceType":       dbus.MakeVariant(uint32(1)),
+		"Interface":        dbus.MakeVariant("eth0"),
+		"ActiveConnection": dbus.MakeVariant(dbus.ObjectPath("/")),
+	}, ethernet, "org.freedesktop.DBus.Properties")
+
+	export(fakeProperties{
+		"DeviceType":       dbus.MakeVariant(uint32(32)),
+		"Interface":        dbus.MakeVariant("lo"),
+		"ActiveConnection": dbus.MakeVariant(dbus.ObjectPath(NM_PATH + "/ActiveConnection/3")),
+		"Ip4Config":        dbus.MakeVariant(dbus.ObjectPath("/")),
+		"Ip6Config":        dbus.MakeVariant(dbus.ObjectPath("/")),
+	}, loopback, "org.freedesktop.DBus.Properties")
+
+	activeConnections := []fakeProperties{
+		{"Id": dbus.MakeVariant("Home"), "Type": dbus.MakeVariant("802-11-wireless"), "Vpn": dbus.MakeVariant(false),
+			"Devices": dbus.MakeVariant([]dbus.ObjectPath{wifi})},
+		{"Id": dbus.MakeVariant("Work"), "Type": dbus.MakeVariant("vpn"), "Vpn": dbus.MakeVariant(true),
+			"Devices": dbus.MakeVariant([]dbus.ObjectPath{wifi})},
+		{"Id": dbus.MakeVariant("lo"), "Type": dbus.MakeVariant("loopback"), "Vpn": dbus.MakeVariant(false),
+			"Devices": dbus.MakeVariant([]dbus.ObjectPath{loopback})},
+		// without an id
+		{"Type": dbus.MakeVariant("tun"), "Vpn": dbus.MakeVariant(false)},
+	}
+	for idx, props := range activeConnections {
+		export(props, dbus.ObjectPath(fmt.Sprintf("%s/ActiveConnection/%d", NM_PATH, idx+1)), "org.freedesktop.DBus.Properties")
+	}
+	export(fakeProperties{
+		"AddressData": dbus.MakeVariant([]map[string]dbus.Variant{
+			{"address": dbus.MakeVariant("192.168.1.10"), "prefix": dbus.MakeVariant(uint32(24))},
+		}),
+	}, NM_PATH+"/IP4Config/1", "org.freedesktop.DBus.Properties")
+
+	aps := []struct {
+		ssid     string
+		strength uint8
+		flags    uint32
+		rsnFlags uint32
+	}{
+		{"home", 40, 0x1, 0x188},
+		{"home", 80, 0x1, 0x188},
+		{"cafe", 60, 0x0, 0x0},
+		// hidden
+		{"", 90, 0x1, 0x188},
+	}
+
+	paths := make(fakeWireless, 0)
+	for idx, ap := range aps {
+		path := dbus.ObjectPath(fmt.Sprintf("%s/AccessPoint/%d", NM_PATH, idx+1))
+		export(fakeProperties{
+			"Ssid":     dbus.MakeVariant([]byte(ap.ssid)),
+			"Strength": dbus.MakeVariant(ap.strength),
+			"Flags":    dbus.MakeVariant(ap.flags),
+			"WpaFlags": dbus.MakeVariant(uint32(0)),
+			"RsnFlags": dbus.MakeVariant(ap.rsnFlags),
+		}, path, "org.freedesktop.DBus.Properties")
+		paths = append(paths, path)
+	}
+	export(paths, wifi, "org.freedesktop.NetworkManager.Device.Wireless")
+
+	export(fakeSettings{NM_PATH + "/Settings/1", NM_PATH + "/Settings/2"},
+		NM_PATH+"/Settings", "org.freedesktop.NetworkManager.Settings")
+	export(fakeConnection{
+		"connection": {"id": dbus.MakeVariant("Wired")},
+	}, NM_PATH+"/Settings/1", "org.freedesktop.NetworkManager.Settings.Connection")
+	export(fakeConnection{
+		"connection":      {"id": dbus.MakeVariant("Home")},
+		"802-11-wireless": {"ssid": dbus.MakeVariant([]byte("home"))},
+	}, NM_PATH+"/Settings/2", "org.freedesktop.NetworkManager.Settings.Connection")
+
+	reply, err := conn.RequestName("org.freedesktop.NetworkManager", dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own the NetworkManager name: %v", err)
+	}
+	return nm
+}
+
+func newTestNmBackend(t *testing.T) (*nmBackend, *fakeNetworkManager) {
+	address := startPrivateBus(t)
+	nm := exportFakeNetworkManager(t, connectPrivateBus(t, address))
+
+	backend := newNmBackend(NetworkConfig{})
+	backend.dbus = connectPrivateBus(t, address)
+	return backend, nm
+}
+
+func TestNmAccessPoints(t *testing.T) {
+	backend, _ := newTestNmBackend(t)
+
+	aps, err := backend.accessPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one per ssid, the strongest first, without hidden networks
+	if len(aps) != 2 {
+		t.Fatalf("got %d access points, want 2", len(aps))
+	}
+	if aps[0].ssid != "home" || aps[0].strength != 80 || !aps[0].secured || aps[0].path != NM_PATH+"/AccessPoint/2" {
+		t.Errorf("got %+v, want the strongest home access point", aps[0])
+	}
+	if aps[1].ssid != "cafe" || aps[1].strength != 60 || aps[1].secured {
+		t.Errorf("got %+v, want the open cafe access point", aps[1])
+	}
+	if aps[0].device != NM_PATH+"/Devices/1" {
+		t.Errorf("device %s, want the wifi device", aps[0].device)
+	}
+}
+
+func TestNmConnect(t *testing.T) {
+	backend, nm := newTestNmBackend(t)
+
+	aps, err := backend.accessPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ap := range aps {
+		if err := backend.connect(ap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		// the saved connection for home is activated
+		"activate /org/freedesktop/NetworkManager/Settings/2 /org/freedesktop/NetworkManager/Devices/1 /org/freedesktop/NetworkManager/AccessPoint/2",
+		// and a new one is added for the cafe
+		"add /org/freedesktop/NetworkManager/Devices/1 /org/freedesktop/NetworkManager/AccessPoint/3",
+	}
+	nm.Lock()
+	defer nm.Unlock()
+	if strings.Join(nm.activated, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", nm.activated, want)
+	}
+}
+
+func TestNmFindConnection(t *testing.T) {
+	backend, _ := newTestNmBackend(t)
+
+	if connection, err := backend.findConnection("home"); err != nil || connection != NM_PATH+"/Settings/2" {
+		t.Errorf("got %s, %v, want the saved home connection", connection, err)
+	}
+	if connection, err := backend.findConnection("Wired"); err != nil || connection != "" {
+		t.Errorf("got %s, %v, want no connection", connection, err)
+	}
+}
+
+// updateInfo returns the network info the backend sends
+func updateInfo(t *testing.T, backend *nmBackend) *networkInfo {
+	t.Helper()
+
+	go backend.updateNetworkManagerInfo()
+	select {
+	case result := <-backend.nmInfoChannel:
+		return result.info
+	case <-time.After(5 * time.Second):
+		t.Fatal("no network info")
+		return nil
+	}
+}
+
+func TestNmNetworkInfo(t *testing.T) {
+	backend, _ := newTestNmBackend(t)
+	backend.config.Throughput = true
+
+	info := updateInfo(t, backend)
+	if len(info.connections) != 2 {
+		t.Fatalf("got %d connections, want lo and the wifi", len(info.connections))
+	}
+
+	// the device the vpn goes through, not lo
+	primary := info.primaryConnection
+	if primary == nil || primary.ifName != "wlan0" || primary.ip4 != "192.168.1.10" {
+		t.Fatalf("got %+v, want wlan0", primary)
+	}
+	if data, ok := primary.data.(*wifiData); !ok || data.ssid != "home" || data.signalQuality != 80 {
+		t.Errorf("got %+v, want the home access point", primary.data)
+	}
+	if len(info.vpns) != 1 || info.vpns[0] != "Work" {
+		t.Errorf("got vpns %v, want Work", info.vpns)
+	}
+}
+
+func TestNmStatisticsFallback(t *testing.T) {
+	backend, _ := newTestNmBackend(t)
+
+	// the counters of the kernel are used without the Statistics interface
+	statistics, err := backend.statistics(&netConnection{device: NM_PATH + "/Devices/1", ifName: "lo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statistics.ifName != "lo" {
+		t.Errorf("got statistics of %s", statistics.ifName)
+	}
+}
@@ -0,0 +1,296 @@
+package widget
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+const NETROUTEFILE = "/proc/net/route"
+const NETWIRELESSFILE = "/proc/net/wireless"
+const NETDEVFILE = "/proc/net/dev"
+
+// rtnetlink multicast groups, from linux/rtnetlink.h
+const RTMGRP_LINK = 0x1
+const RTMGRP_IPV4_IFADDR = 0x10
+const RTMGRP_IPV4_ROUTE = 0x40
+const RTMGRP_IPV6_IFADDR = 0x100
+
+// refresh interval for the signal quality, which rtnetlink doesn't notify about
+const PROC_POLL_INTERVAL = 30 * time.Second
+
+// procBackend is used when NetworkManager isn't available, e.g. with
+// systemd-networkd or iwd. changes are picked up from rtnetlink, and the
+// state is read from /proc/net and /sys/class/net
+type procBackend struct {
+	netlinkFd int
+	changed   chan struct{}
+}
+
+func newProcBackend() *procBackend {
+	return &procBackend{
+		netlinkFd: -1,
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+func (p *procBackend) setup() error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+
+	// links, addresses and routes being added or removed
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: RTMGRP_LINK | RTMGRP_IPV4_IFADDR | RTMGRP_IPV6_IFADDR | RTMGRP_IPV4_ROUTE,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return os.NewSyscallError("bind", err)
+	}
+
+	p.netlinkFd = fd
+	return nil
+}
+
+func (p *procBackend) close() {
+	if p.netlinkFd != -1 {
+		syscall.Close(p.netlinkFd)
+	}
+}
+
+func (p *procBackend) run(infoChannel chan<- *networkInfo) {
+	if p.netlinkFd != -1 {
+		go p.readNetlink()
+	}
+
+	infoUpdate := time.NewTicker(PROC_POLL_INTERVAL)
+
+	// set while a refresh is pending after a netlink message
+	var debounce <-chan time.Time
+
+	infoChannel <- p.readInfo()
+	for {
+		select {
+		case <-p.changed:
+			if debounce == nil {
+				debounce = time.After(NETWORK_DEBOUNCE)
+			}
+
+		case <-debounce:
+			debounce = nil
+			infoChannel <- p.readInfo()
+
+		case <-infoUpdate.C:
+			infoChannel <- p.readInfo()
+		}
+	}
+}
+
+// statistics reads the byte counters of an interface from /proc/net/dev
+func (p *procBackend) statistics(connection *netConnection) (*netStatistics, error) {
+	return readProcStatistics(connection.ifName)
+}
+
+// readProcStatistics is also the fallback of the NetworkManager backend
+func readProcStatistics(ifName string) (*netStatistics, error) {
+	file, err := os.Open(NETDEVFILE)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// e.g. wlan0: 1234 5 0 0 0 0 0 0 5678 9 ...
+		name, counters, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(name) != ifName {
+			continue
+		}
+
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			break
+		}
+
+		rxBytes, _ := strconv.ParseUint(fields[0], 10, 64)
+		txBytes, _ := strconv.ParseUint(fields[8], 10, 64)
+		return &netStatistics{
+			ifName:  ifName,
+			time:    time.Now(),
+			rxBytes: rxBytes,
+			txBytes: txBytes,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("interface %s not found in %s", ifName, NETDEVFILE)
+}
+
+// readNetlink signals a change for every rtnetlink message
+func (p *procBackend) readNetlink() {
+	buf := make([]byte, os.Getpagesize())
+	for {
+		if _, _, err := syscall.Recvfrom(p.netlinkFd, buf, 0); err != nil {
+			if err == syscall.EINTR || err == syscall.ENOBUFS {
+				continue
+			}
+			log.Printf("failed to read from netlink: %s", err.Error())
+			return
+		}
+
+		select {
+		case p.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// readInfo returns the interface with the default route as the primary connection
+func (p *procBackend) readInfo() *networkInfo {
+	info := &networkInfo{connections: make([]*netConnection, 0)}
+
+	ifName, err := readDefaultRoute()
+	if err != nil {
+		log.Printf("failed to read default route: %s", err.Error())
+		return info
+	} else if ifName == "" {
+		return info
+	}
+
+	connection := &netConnection{
+		ifName:  ifName,
+		netType: typeEthernet,
+	}
+
+	if iface, err := net.InterfaceByName(ifName); err == nil {
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				ipNet, ok := addr.(*net.IPNet)
+				if !ok {
+					continue
+				}
+
+				if ipNet.IP.To4() != nil && connection.ip4 == "" {
+					connection.ip4 = ipNet.IP.String()
+				} else if ipNet.IP.To4() == nil && !ipNet.IP.IsLinkLocalUnicast() && connection.ip6 == "" {
+					connection.ip6 = ipNet.IP.String()
+				}
+			}
+		}
+	}
+
+	if _, err := os.Stat("/sys/class/net/" + ifName + "/wireless"); err == nil {
+		// the ssid and bitrate need nl80211, which isn't worth it here
+		connection.netType = typeWifi
+		connection.data = &wifiData{signalQuality: readSignalQuality(ifName)}
+	} else {
+		ethernetInfo := &ethernetData{}
+		if speed, err := util.ReadFileInt("/sys/class/net/" + ifName + "/speed"); err == nil && speed > 0 {
+			ethernetInfo.speed = uint32(speed)
+		}
+		connection.data = ethernetInfo
+	}
+
+	info.connections = append(info.connections, connection)
+	info.primaryConnection = connection
+	info.vpns = readTunnels()
+	return info
+}
+
+// readTunnels returns the names of tun and wireguard interfaces that are up
+func readTunnels() []string {
+	tunnels := make([]string, 0)
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return tunnels
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		dir := "/sys/class/net/" + iface.Name
+		uevent, _ := os.ReadFile(dir + "/uevent")
+		if _, err := os.Stat(dir + "/tun_flags"); err == nil || strings.Contains(string(uevent), "DEVTYPE=wireguard") {
+			tunnels = append(tunnels, iface.Name)
+		}
+	}
+
+	return tunnels
+}
+
+// readDefaultRoute returns the interface of the default route with the lowest metric
+func readDefaultRoute() (string, error) {
+	file, err := os.Open(NETROUTEFILE)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	ifName := ""
+	lowestMetric := -1
+
+	scanner := bufio.NewScanner(file)
+	// skip header
+	scanner.Scan()
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		// RTF_UP
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&0x1 == 0 {
+			continue
+		}
+
+		metric, _ := strconv.Atoi(fields[6])
+		if lowestMetric == -1 || metric < lowestMetric {
+			ifName = fields[0]
+			lowestMetric = metric
+		}
+	}
+
+	return ifName, scanner.Err()
+}
+
+// readSignalQuality returns the link quality of a wireless interface in percent
+func readSignalQuality(ifName string) uint8 {
+	file, err := os.Open(NETWIRELESSFILE)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// e.g. wlan0: 0000   58.  -52.  -256        0      0      0      0     12        0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.TrimSuffix(fields[0], ":") != ifName {
+			continue
+		}
+
+		// link quality is out of 70 for most drivers
+		quality, _ := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		percent := quality * 100 / 70
+		if percent > 100 {
+			percent = 100
+		}
+		return uint8(percent)
+	}
+
+	return 0
+}
@@ -0,0 +1,148 @@
+package widget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestNetwork(config NetworkConfig) *Network {
+	return NewNetworkWidget(config).impl.(*Network)
+}
+
+func TestNetworkThroughputMinWidth(t *testing.T) {
+	network := newTestNetwork(NetworkConfig{Throughput: true})
+	ethernet := &netConnection{ifName: "eth0", netType: typeEthernet, data: &ethernetData{speed: 1000}}
+	network.connections = []*netConnection{ethernet}
+	network.primaryConnection = ethernet
+	network.rxRate = 1536
+	network.txRate = 0
+
+	block := &block{}
+	network.update(block)
+
+	prefix := fmt.Sprintf("%c eth0 ", ICON_ETHERNET)
+	if want := prefix + "⇣1.5K/s ⇡0B/s"; block.FullText != want {
+		t.Errorf("got %q, want %q", block.FullText, want)
+	}
+	if want := prefix + "⇣000.0K/s ⇡000.0K/s"; block.MinWidth != want {
+		t.Errorf("min width %q, want %q", block.MinWidth, want)
+	}
+
+	network.connections = nil
+	network.update(block)
+	if block.MinWidth != "" {
+		t.Errorf("min width %q without a connection", block.MinWidth)
+	}
+}
+
+// fakeWifi records the access point connected to
+type fakeWifi struct {
+	aps       []*accessPoint
+	connected *accessPoint
+}
+
+func (f *fakeWifi) accessPoints() ([]*accessPoint, error) {
+	return f.aps, nil
+}
+
+func (f *fakeWifi) connect(ap *accessPoint) error {
+	f.connected = ap
+	return nil
+}
+
+func TestNetworkPickWifi(t *testing.T) {
+	optionsFile := filepath.Join(t.TempDir(), "options")
+	wifi := &fakeWifi{aps: []*accessPoint{
+		{ssid: "home", strength: 80, secured: true},
+		{ssid: "cafe", strength: 30},
+	}}
+
+	// the launcher saves the options and picks the second one
+	network := newTestNetwork(NetworkConfig{
+		Launcher: []string{"sh", "-c", fmt.Sprintf("cat > %s; sed -n 2p %s", optionsFile, optionsFile)},
+	})
+	network.pickWifi(wifi)
+
+	options, err := os.ReadFile(optionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%c home 80%% %c\n%c cafe 30%%", ICON_WIFI_4, ICON_LOCK, ICON_WIFI_2)
+	if string(options) != want {
+		t.Errorf("options %q, want %q", options, want)
+	}
+	if wifi.connected != wifi.aps[1] {
+		t.Errorf("connected to %+v, want cafe", wifi.connected)
+	}
+}
+
+func TestNetworkPickWifiDismissed(t *testing.T) {
+	wifi := &fakeWifi{aps: []*accessPoint{{ssid: "home", strength: 80}}}
+
+	// dmenu style launchers exit with an error when dismissed
+	network := newTestNetwork(NetworkConfig{Launcher: []string{"sh", "-c", "cat > /dev/null; exit 1"}})
+	network.pickWifi(wifi)
+
+	if wifi.connected != nil {
+		t.Errorf("connected to %+v after dismissing the launcher", wifi.connected)
+	}
+}
+
+// fakeNetBackend sends a number of network states, alternating between
+// a connection and none
+type fakeNetBackend struct {
+	updates int
+}
+
+func (f *fakeNetBackend) setup() error { return nil }
+func (f *fakeNetBackend) close()       {}
+
+func (f *fakeNetBackend) run(infoChannel chan<- *networkInfo) {
+	for i := 0; i < f.updates; i++ {
+		info := &networkInfo{}
+		if i%2 == 0 {
+			ethernet := &netConnection{ifName: "eth0", netType: typeEthernet, data: &ethernetData{}}
+			info.connections = []*netConnection{ethernet}
+			info.primaryConnection = ethernet
+		}
+		infoChannel <- info
+	}
+}
+
+func (f *fakeNetBackend) statistics(connection *netConnection) (*netStatistics, error) {
+	return nil, fmt.Errorf("no statistics")
+}
+
+// drainUpdates sets up the queue of a widget and discards its updates
+func drainUpdates(t *testing.T, widget *Widget) {
+	queue := make(chan []*Update, 10)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	widget.queue = queue
+	go func() {
+		for {
+			select {
+			case <-queue:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func TestNetworkClickWhileUpdating(t *testing.T) {
+	widget := NewNetworkWidget(NetworkConfig{})
+	network := widget.impl.(*Network)
+	network.backend = &fakeNetBackend{updates: 100}
+	drainUpdates(t, widget)
+
+	go network.run()
+
+	// the connections have no address, so nothing is copied
+	for i := 0; i < 100; i++ {
+		widget.OnClick(0, 0, 3)
+	}
+}
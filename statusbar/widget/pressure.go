@@ -0,0 +1,143 @@
+package widget
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type PressureConfig struct {
+	// ProcRoot is the mount point of procfs, defaults to /proc
+	ProcRoot string
+
+	// memory stall percentages at or above which the widget is colored and set urgent
+	MemoryWarningThreshold float64
+	MemoryUrgentThreshold  float64
+
+	// LoadAverage also shows the 1, 5 and 15 minute load averages
+	LoadAverage bool
+}
+
+// psiData is the avg10 share of time some task was stalled on a resource
+type psiData struct {
+	cpu    float64
+	memory float64
+	io     float64
+}
+
+type Pressure struct {
+	*Widget
+	config PressureConfig
+}
+
+func NewPressureWidget(config PressureConfig) *Widget {
+	if config.ProcRoot == "" {
+		config.ProcRoot = "/proc"
+	}
+	if config.MemoryWarningThreshold == 0 {
+		config.MemoryWarningThreshold = 5
+	}
+	if config.MemoryUrgentThreshold == 0 {
+		config.MemoryUrgentThreshold = 20
+	}
+
+	return newWidget("pressure", 4000, func(widget *Widget) impl {
+		return &Pressure{
+			Widget: widget,
+			config: config,
+		}
+	})
+}
+
+func (p *Pressure) setup() {}
+
+func (p *Pressure) close() {}
+
+func (p *Pressure) run() {}
+
+func (p *Pressure) update(block *block) {
+	psi, err := p.readPressure()
+	if err != nil {
+		// kernels without CONFIG_PSI, or booted with psi=0
+		log.Printf("failed to read pressure: %s", err.Error())
+		block.FullText = ""
+		return
+	}
+
+	block.FullText = fmt.Sprintf("PSI %.1f/%.1f/%.1f", psi.cpu, psi.memory, psi.io)
+
+	if p.config.LoadAverage {
+		if load, err := p.readLoadAverage(); err != nil {
+			log.Printf("failed to read load average: %s", err.Error())
+		} else {
+			block.FullText += " LOAD " + load
+		}
+	}
+
+	block.Urgent = psi.memory >= p.config.MemoryUrgentThreshold
+	if psi.memory >= p.config.MemoryWarningThreshold {
+		block.Color = COLOR_WARNING
+	} else {
+		block.Color = ""
+	}
+}
+
+func (p *Pressure) onClick(x int, y int, btn int) {}
+
+func (p *Pressure) readPressure() (*psiData, error) {
+	psi := &psiData{}
+	var err error
+
+	if psi.cpu, err = readPsiFile(filepath.Join(p.config.ProcRoot, "pressure/cpu")); err != nil {
+		return nil, err
+	}
+	if psi.memory, err = readPsiFile(filepath.Join(p.config.ProcRoot, "pressure/memory")); err != nil {
+		return nil, err
+	}
+	if psi.io, err = readPsiFile(filepath.Join(p.config.ProcRoot, "pressure/io")); err != nil {
+		return nil, err
+	}
+
+	return psi, nil
+}
+
+// readLoadAverage returns the first three fields of /proc/loadavg, e.g. "0.52 0.58 0.59"
+func (p *Pressure) readLoadAverage() (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.config.ProcRoot, "loadavg"))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected loadavg format")
+	}
+	return strings.Join(fields[:3], " "), nil
+}
+
+// readPsiFile returns avg10 from the "some" line of a pressure file such as
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPsiFile(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no avg10 in %s", path)
+}
@@ -0,0 +1,206 @@
+package widget
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+// nf-md-thermometer
+const ICON_THERMOMETER = '󰔏'
+
+// nf-md-fan
+const ICON_FAN = '󰈐'
+
+type TemperatureConfig struct {
+	// SysfsRoot is the mount point of sysfs, defaults to /sys
+	SysfsRoot string
+
+	// Sensors selects which sensors to show the maximum of, defaults to all.
+	// a hwmon sensor is selected by driver name and optionally label, e.g.
+	// "k10temp/Tctl" or "coretemp/Package id 0". a thermal zone is selected
+	// by its type, e.g. "x86_pkg_temp"
+	Sensors []string
+
+	// temperatures in °C at or above which the widget is colored and set urgent
+	WarningThreshold int
+	UrgentThreshold  int
+
+	// ShowFan also shows the speed of the fastest fan
+	ShowFan bool
+}
+
+// sensor is a temperature or fan input file, along with the name it is selected by
+type sensor struct {
+	// e.g. k10temp/Tctl
+	id   string
+	path string
+}
+
+type Temperature struct {
+	*Widget
+	config TemperatureConfig
+
+	sensors []*sensor
+	fans    []*sensor
+}
+
+func NewTemperatureWidget(config TemperatureConfig) *Widget {
+	if config.SysfsRoot == "" {
+		config.SysfsRoot = "/sys"
+	}
+	if config.WarningThreshold == 0 {
+		config.WarningThreshold = 75
+	}
+	if config.UrgentThreshold == 0 {
+		config.UrgentThreshold = 90
+	}
+
+	return newWidget("temperature", 4000, func(widget *Widget) impl {
+		return &Temperature{
+			Widget: widget,
+			config: config,
+		}
+	})
+}
+
+func (t *Temperature) setup() {
+	t.discoverSensors()
+}
+
+func (t *Temperature) close() {}
+
+func (t *Temperature) run() {}
+
+func (t *Temperature) update(block *block) {
+	temp, err := t.readMax(t.sensors)
+	if err != nil {
+		// hwmon devices may have been registered late or renumbered
+		t.discoverSensors()
+		if temp, err = t.readMax(t.sensors); err != nil {
+			log.Printf("failed to read temperature: %s", err.Error())
+			block.FullText = ""
+			return
+		}
+	}
+
+	// temperatures are in millidegrees
+	celsius := temp / 1000
+	block.FullText = fmt.Sprintf("%c %d°C", ICON_THERMOMETER, celsius)
+
+	if t.config.ShowFan {
+		if rpm, err := t.readMax(t.fans); err == nil {
+			block.FullText += fmt.Sprintf(" %c %drpm", ICON_FAN, rpm)
+		}
+	}
+
+	block.Urgent = celsius >= int64(t.config.UrgentThreshold)
+	if celsius >= int64(t.config.WarningThreshold) {
+		block.Color = COLOR_WARNING
+	} else {
+		block.Color = ""
+	}
+}
+
+func (t *Temperature) onClick(x int, y int, btn int) {}
+
+// readMax returns the highest value of the sensors. sensors that fail to read,
+// such as those of a suspended gpu, are skipped
+func (t *Temperature) readMax(sensors []*sensor) (int64, error) {
+	if len(sensors) == 0 {
+		return 0, fmt.Errorf("no sensors found")
+	}
+
+	var max int64
+	var lastErr error
+	readable := 0
+	for _, s := range sensors {
+		value, err := util.ReadFileInt(s.path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if readable == 0 || value > max {
+			max = value
+		}
+		readable++
+	}
+
+	if readable == 0 {
+		return 0, lastErr
+	}
+	return max, nil
+}
+
+// discoverSensors finds the selected sensors by name and label, since the
+// hwmonN and thermal_zoneN numbering may change between boots
+func (t *Temperature) discoverSensors() {
+	t.sensors = make([]*sensor, 0)
+	t.fans = make([]*sensor, 0)
+
+	hwmons, _ := filepath.Glob(filepath.Join(t.config.SysfsRoot, "class/hwmon/hwmon*"))
+	for _, hwmon := range hwmons {
+		name, err := util.ReadFileString(filepath.Join(hwmon, "name"))
+		if err != nil {
+			continue
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+		for _, input := range inputs {
+			id := name
+			labelFile := strings.TrimSuffix(input, "_input") + "_label"
+			if label, err := util.ReadFileString(labelFile); err == nil {
+				id += "/" + label
+			}
+
+			if t.isSelected(id) {
+				t.sensors = append(t.sensors, &sensor{id: id, path: input})
+			}
+		}
+
+		fans, _ := filepath.Glob(filepath.Join(hwmon, "fan*_input"))
+		for _, fan := range fans {
+			t.fans = append(t.fans, &sensor{id: name, path: fan})
+		}
+	}
+
+	zones, _ := filepath.Glob(filepath.Join(t.config.SysfsRoot, "class/thermal/thermal_zone*"))
+	for _, zone := range zones {
+		zoneType, err := util.ReadFileString(filepath.Join(zone, "type"))
+		if err != nil {
+			continue
+		}
+
+		// without a selection, thermal zones mostly duplicate hwmon sensors
+		if len(t.config.Sensors) == 0 && len(hwmons) > 0 {
+			continue
+		}
+
+		if t.isSelected(zoneType) {
+			t.sensors = append(t.sensors, &sensor{id: zoneType, path: filepath.Join(zone, "temp")})
+		}
+	}
+
+	for _, s := range t.sensors {
+		log.Printf("using temperature sensor %s (%s)", s.id, s.path)
+	}
+}
+
+// isSelected returns true if the sensor id matches the config. selecting
+// only the driver name selects all of its sensors
+func (t *Temperature) isSelected(id string) bool {
+	if len(t.config.Sensors) == 0 {
+		return true
+	}
+
+	for _, selected := range t.config.Sensors {
+		if id == selected || strings.HasPrefix(id, selected+"/") {
+			return true
+		}
+	}
+	return false
+}
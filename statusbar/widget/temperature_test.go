@@ -0,0 +1,63 @@
+package widget
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemperatureSkipsUnreadableSensors(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/hwmon/hwmon0", map[string]string{
+		"name":        "k10temp",
+		"temp1_input": "45000",
+		"temp1_label": "Tctl",
+	})
+	writeSysfs(t, root, "class/hwmon/hwmon1", map[string]string{
+		"name": "amdgpu",
+	})
+	// reading a directory fails, like a suspended gpu returning EIO
+	if err := os.Mkdir(filepath.Join(root, "class/hwmon/hwmon1/temp1_input"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	temperature := NewTemperatureWidget(TemperatureConfig{SysfsRoot: root}).impl.(*Temperature)
+	temperature.setup()
+	if len(temperature.sensors) != 2 {
+		t.Fatalf("found %d sensors, want 2", len(temperature.sensors))
+	}
+
+	if temp, err := temperature.readMax(temperature.sensors); err != nil || temp != 45000 {
+		t.Errorf("got %d, %v, want 45000", temp, err)
+	}
+
+	// an error only when no sensor can be read
+	if _, err := temperature.readMax(temperature.sensors[1:]); err == nil {
+		t.Error("expected an error without readable sensors")
+	}
+}
+
+func TestTemperatureSelection(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, "class/hwmon/hwmon0", map[string]string{
+		"name":        "coretemp",
+		"temp1_input": "50000",
+		"temp1_label": "Package id 0",
+		"temp2_input": "70000",
+		"temp2_label": "Core 0",
+	})
+	writeSysfs(t, root, "class/thermal/thermal_zone0", map[string]string{
+		"type": "x86_pkg_temp",
+		"temp": "55000",
+	})
+
+	temperature := NewTemperatureWidget(TemperatureConfig{
+		SysfsRoot: root,
+		Sensors:   []string{"coretemp/Package id 0", "x86_pkg_temp"},
+	}).impl.(*Temperature)
+	temperature.setup()
+
+	if temp, err := temperature.readMax(temperature.sensors); err != nil || temp != 55000 {
+		t.Errorf("got %d, %v, want 55000 from the selected sensors", temp, err)
+	}
+}
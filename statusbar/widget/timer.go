@@ -0,0 +1,408 @@
+package widget
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+// nf-md-play
+const ICON_PLAY = '󰐊'
+
+// nf-md-pause
+const ICON_PAUSE = '󰏤'
+
+type TimerConfig struct {
+	// lengths of the pomodoro phases in minutes, default to 25, 5 and 15
+	WorkMinutes      int
+	BreakMinutes     int
+	LongBreakMinutes int
+	// LongBreakEvery is how many work phases there are before a long break, defaults to 4
+	LongBreakEvery int
+	// Step is how many minutes scrolling adds or removes, defaults to 1
+	Step int
+	// StateFile keeps the timer across restarts, defaults to
+	// $XDG_STATE_HOME/statusbar-sway/timer.json
+	StateFile string
+}
+
+type timerPhase string
+
+const (
+	phaseWork      timerPhase = "work"
+	phaseBreak     timerPhase = "break"
+	phaseLongBreak timerPhase = "long_break"
+	// an arbitrary countdown, after which the pomodoro cycle starts over
+	phaseCountdown timerPhase = "countdown"
+)
+
+// timerState is saved to the state file on every change
+type timerState struct {
+	Phase   timerPhase `json:"phase"`
+	Running bool       `json:"running"`
+	// when the phase ends, while running
+	EndsAt time.Time `json:"ends_at"`
+	// what is left of the phase, while paused
+	Remaining time.Duration `json:"remaining"`
+	// work phases since the last long break
+	Completed int `json:"completed"`
+	// set when a phase has ended, until the timer is started again
+	Finished bool `json:"finished"`
+}
+
+type Timer struct {
+	*Widget
+	sync.Mutex
+	config TimerConfig
+	state  timerState
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func NewTimerWidget(config TimerConfig) *Widget {
+	if config.WorkMinutes == 0 {
+		config.WorkMinutes = 25
+	}
+	if config.BreakMinutes == 0 {
+		config.BreakMinutes = 5
+	}
+	if config.LongBreakMinutes == 0 {
+		config.LongBreakMinutes = 15
+	}
+	if config.LongBreakEvery == 0 {
+		config.LongBreakEvery = 4
+	}
+	if config.Step == 0 {
+		config.Step = 1
+	}
+
+	return newWidget("timer", 1000, func(widget *Widget) impl {
+		t := &Timer{
+			Widget: widget,
+			config: config,
+			now:    time.Now,
+		}
+		t.reset()
+		return t
+	})
+}
+
+// load the state of the previous run
+func (t *Timer) setup() {
+	if t.config.StateFile == "" {
+		if path, err := timerStatePath(); err != nil {
+			log.Printf("failed to find timer state directory: %s", err.Error())
+			return
+		} else {
+			t.config.StateFile = path
+		}
+	}
+
+	data, err := os.ReadFile(t.config.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read timer state: %s", err.Error())
+		}
+		return
+	}
+
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		log.Printf("failed to parse timer state: %s", err.Error())
+		t.reset()
+	}
+}
+
+func (t *Timer) close() {}
+
+// end phases when their time is up, also when that was while the bar wasn't running
+func (t *Timer) run() {
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		if ended, next, finished := t.tick(); finished {
+			t.notify(ended, next)
+			t.sendUpdate()
+		}
+	}
+}
+
+// tick ends the phase if its time is up, and returns the ended and the next phase
+func (t *Timer) tick() (timerPhase, timerPhase, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	ended := t.state.Phase
+	finished := t.state.Running && !t.now().Before(t.state.EndsAt)
+	if finished {
+		t.advance()
+		t.state.Finished = true
+		t.save()
+	}
+	return ended, t.state.Phase, finished
+}
+
+func (t *Timer) update(block *block) {
+	t.Lock()
+	defer t.Unlock()
+
+	icon := ICON_PAUSE
+	if t.state.Running {
+		icon = ICON_PLAY
+	}
+
+	labels := map[timerPhase]string{
+		phaseWork:      "WORK",
+		phaseBreak:     "BREAK",
+		phaseLongBreak: "LONG BREAK",
+		phaseCountdown: "TIMER",
+	}
+
+	block.FullText = fmt.Sprintf("%c %s %s", icon, labels[t.state.Phase], formatRemaining(t.remaining()))
+	block.Urgent = t.state.Finished
+
+	if t.state.Running && (t.state.Phase == phaseBreak || t.state.Phase == phaseLongBreak) {
+		block.Color = COLOR_GOOD
+	} else {
+		block.Color = ""
+	}
+}
+
+// left click starts or pauses, middle click skips to the next phase, right click
+// resets and scrolling adds or removes minutes
+func (t *Timer) onClick(x int, y int, btn int) {
+	t.Lock()
+	switch btn {
+	case 1:
+		t.toggle()
+	case 2:
+		t.advance()
+	case 3:
+		t.reset()
+	case 4:
+		t.add(time.Duration(t.config.Step) * time.Minute)
+	case 5:
+		t.add(-time.Duration(t.config.Step) * time.Minute)
+	default:
+		t.Unlock()
+		return
+	}
+	t.save()
+	t.Unlock()
+
+	t.sendUpdate()
+}
+
+// onCommand handles start [minutes], pause, toggle, skip, reset, add <minutes>
+// and status. start with minutes begins a countdown
+func (t *Timer) onCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("missing command")
+	}
+
+	minutes := 0
+	if len(args) > 1 {
+		var err error
+		if minutes, err = strconv.Atoi(args[1]); err != nil {
+			return "", fmt.Errorf("invalid minutes %s", args[1])
+		}
+	}
+
+	t.Lock()
+	switch args[0] {
+	case "start":
+		if minutes > 0 {
+			t.state = timerState{
+				Phase:     phaseCountdown,
+				Remaining: time.Duration(minutes) * time.Minute,
+				Completed: t.state.Completed,
+			}
+		}
+		t.start()
+	case "pause":
+		t.pause()
+	case "toggle":
+		t.toggle()
+	case "skip":
+		t.advance()
+	case "reset":
+		t.reset()
+	case "add":
+		t.add(time.Duration(minutes) * time.Minute)
+	case "status":
+	default:
+		t.Unlock()
+		return "", fmt.Errorf("unknown command %s", args[0])
+	}
+	t.save()
+
+	status := fmt.Sprintf("%s %s", t.state.Phase, formatRemaining(t.remaining()))
+	if !t.state.Running {
+		status += " paused"
+	}
+	t.Unlock()
+
+	t.sendUpdate()
+	return status, nil
+}
+
+// the methods below expect the timer to be locked
+
+func (t *Timer) start() {
+	if !t.state.Running {
+		t.state.EndsAt = t.now().Add(t.state.Remaining)
+		t.state.Running = true
+		t.state.Finished = false
+	}
+}
+
+func (t *Timer) pause() {
+	if t.state.Running {
+		t.state.Remaining = t.remaining()
+		t.state.Running = false
+	}
+}
+
+func (t *Timer) toggle() {
+	if t.state.Running {
+		t.pause()
+	} else {
+		t.start()
+	}
+}
+
+// reset goes back to the start of the pomodoro cycle
+func (t *Timer) reset() {
+	t.state = timerState{
+		Phase:     phaseWork,
+		Remaining: t.phaseLength(phaseWork),
+	}
+}
+
+// advance stops the timer at the start of the next phase
+func (t *Timer) advance() {
+	switch t.state.Phase {
+	case phaseWork:
+		t.state.Completed++
+		if t.state.Completed >= t.config.LongBreakEvery {
+			t.state.Phase = phaseLongBreak
+			t.state.Completed = 0
+		} else {
+			t.state.Phase = phaseBreak
+		}
+	default:
+		t.state.Phase = phaseWork
+	}
+
+	t.state.Running = false
+	t.state.Finished = false
+	t.state.Remaining = t.phaseLength(t.state.Phase)
+}
+
+// add changes the remaining time, but never below a minute
+func (t *Timer) add(duration time.Duration) {
+	remaining := t.remaining() + duration
+	if remaining < time.Minute {
+		remaining = time.Minute
+	}
+
+	if t.state.Running {
+		t.state.EndsAt = t.now().Add(remaining)
+	} else {
+		t.state.Remaining = remaining
+	}
+}
+
+func (t *Timer) remaining() time.Duration {
+	if !t.state.Running {
+		return t.state.Remaining
+	}
+
+	if remaining := t.state.EndsAt.Sub(t.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (t *Timer) phaseLength(phase timerPhase) time.Duration {
+	switch phase {
+	case phaseBreak:
+		return time.Duration(t.config.BreakMinutes) * time.Minute
+	case phaseLongBreak:
+		return time.Duration(t.config.LongBreakMinutes) * time.Minute
+	default:
+		return time.Duration(t.config.WorkMinutes) * time.Minute
+	}
+}
+
+// save writes the state file, through a rename so a crash never leaves it truncated
+func (t *Timer) save() {
+	if t.config.StateFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(&t.state)
+	if err != nil {
+		log.Printf("failed to encode timer state: %s", err.Error())
+		return
+	}
+
+	tmp := t.config.StateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(t.config.StateFile), 0755); err != nil {
+		log.Printf("failed to save timer state: %s", err.Error())
+	} else if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("failed to save timer state: %s", err.Error())
+	} else if err := os.Rename(tmp, t.config.StateFile); err != nil {
+		log.Printf("failed to save timer state: %s", err.Error())
+	}
+}
+
+// notify shows a notification for the end of a phase
+func (t *Timer) notify(ended timerPhase, next timerPhase) {
+	summary := "Timer finished"
+	body := "Back to work"
+
+	switch ended {
+	case phaseWork:
+		summary = "Work finished"
+		body = "Time for a break"
+		if next == phaseLongBreak {
+			body = "Time for a long break"
+		}
+	case phaseBreak, phaseLongBreak:
+		summary = "Break finished"
+	}
+
+	if err := util.Notify(summary, body); err != nil {
+		log.Printf("failed to send notification: %s", err.Error())
+	}
+}
+
+// timerStatePath returns the state file under $XDG_STATE_HOME, or ~/.local/state
+func timerStatePath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "statusbar-sway", "timer.json"), nil
+}
+
+// formatRemaining formats a duration as m:ss, or h:mm:ss from an hour
+func formatRemaining(remaining time.Duration) string {
+	// rounded up, so 0:00 is only shown when the time is up
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
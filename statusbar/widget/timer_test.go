@@ -0,0 +1,192 @@
+package widget
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// newTestTimer returns a timer with a long break after every second work phase,
+// on a clock that only moves when the returned function is called
+func newTestTimer(t *testing.T, stateFile string, clock *time.Time) (*Widget, *Timer, func(time.Duration)) {
+	if stateFile == "" {
+		stateFile = filepath.Join(t.TempDir(), "timer.json")
+	}
+
+	widget := NewTimerWidget(TimerConfig{LongBreakEvery: 2, StateFile: stateFile})
+	timer := widget.impl.(*Timer)
+	timer.now = func() time.Time { return *clock }
+	timer.setup()
+	drainUpdates(t, widget)
+
+	return widget, timer, func(duration time.Duration) { *clock = clock.Add(duration) }
+}
+
+// timerCommand runs a timer command and checks the reply
+func timerCommand(t *testing.T, timer *Timer, want string, args ...string) {
+	t.Helper()
+
+	if status, err := timer.onCommand(args); err != nil {
+		t.Errorf("%v: %s", args, err.Error())
+	} else if status != want {
+		t.Errorf("%v: got %q, want %q", args, status, want)
+	}
+}
+
+// timerTick ends the phase if its time is up, and checks which phase is next
+func timerTick(t *testing.T, timer *Timer, finished bool, next timerPhase) {
+	t.Helper()
+
+	if _, phase, ok := timer.tick(); ok != finished || phase != next {
+		t.Errorf("tick: got %s finished %t, want %s finished %t", phase, ok, next, finished)
+	}
+}
+
+func TestTimerPhases(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	widget, timer, sleep := newTestTimer(t, "", &clock)
+
+	timerCommand(t, timer, "work 25:00 paused", "status")
+	timerCommand(t, timer, "work 25:00", "start")
+	sleep(10 * time.Minute)
+	timerCommand(t, timer, "work 15:00", "status")
+
+	// the time doesn't run out while paused
+	timerCommand(t, timer, "work 15:00 paused", "pause")
+	sleep(time.Hour)
+	timerTick(t, timer, false, phaseWork)
+	timerCommand(t, timer, "work 15:00", "toggle")
+
+	sleep(15 * time.Minute)
+	timerTick(t, timer, true, phaseBreak)
+	widget.Update()
+	if !widget.block.Urgent || widget.block.Color != "" {
+		t.Errorf("finished work: urgent %t color %q, want urgent", widget.block.Urgent, widget.block.Color)
+	}
+
+	// starting the break clears the finished phase
+	timerCommand(t, timer, "break 5:00", "start")
+	widget.Update()
+	if widget.block.Urgent || widget.block.Color != COLOR_GOOD {
+		t.Errorf("running break: urgent %t color %q, want %q", widget.block.Urgent, widget.block.Color, COLOR_GOOD)
+	}
+	sleep(5 * time.Minute)
+	timerTick(t, timer, true, phaseWork)
+
+	// the second work phase is followed by the long break
+	timerCommand(t, timer, "long_break 15:00 paused", "skip")
+	if timer.state.Completed != 0 {
+		t.Errorf("completed %d after the long break started, want 0", timer.state.Completed)
+	}
+
+	// pausing halfway through the long break keeps it
+	timerCommand(t, timer, "long_break 15:00", "start")
+	sleep(5 * time.Minute)
+	timerCommand(t, timer, "long_break 10:00 paused", "pause")
+	sleep(time.Hour)
+	timerTick(t, timer, false, phaseLongBreak)
+	timerCommand(t, timer, "long_break 10:00", "start")
+	sleep(10 * time.Minute)
+	timerTick(t, timer, true, phaseWork)
+
+	// never below a minute, also while running
+	timerCommand(t, timer, "work 30:00 paused", "add", "5")
+	timerCommand(t, timer, "work 1:00 paused", "add", "-40")
+	timerCommand(t, timer, "work 1:00", "start")
+	timerCommand(t, timer, "work 3:00", "add", "2")
+	timerCommand(t, timer, "work 25:00 paused", "reset")
+
+	// a countdown keeps the completed work phases, and is followed by work
+	timerCommand(t, timer, "break 5:00 paused", "skip")
+	timerCommand(t, timer, "countdown 1:30:00", "start", "90")
+	if timer.state.Completed != 1 {
+		t.Errorf("completed %d during the countdown, want 1", timer.state.Completed)
+	}
+	sleep(90 * time.Minute)
+	timerTick(t, timer, true, phaseWork)
+
+	for _, args := range [][]string{{}, {"stop"}, {"add", "five"}} {
+		if _, err := timer.onCommand(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestTimerRestore(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "statusbar-sway", "timer.json")
+	clock := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	_, timer, sleep := newTestTimer(t, stateFile, &clock)
+	timerCommand(t, timer, "break 5:00 paused", "skip")
+	timerCommand(t, timer, "work 25:00 paused", "skip")
+	timerCommand(t, timer, "work 25:00", "start")
+	sleep(10 * time.Minute)
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved timerState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved, timer.state) {
+		t.Errorf("saved %+v, want %+v", saved, timer.state)
+	}
+
+	// the bar restarts halfway through
+	_, restored, _ := newTestTimer(t, stateFile, &clock)
+	timerCommand(t, restored, "work 15:00", "status")
+	if restored.state.Completed != 1 {
+		t.Errorf("completed %d after restoring, want 1", restored.state.Completed)
+	}
+
+	// and the phase ends while the bar isn't running
+	sleep(time.Hour)
+	_, restored, _ = newTestTimer(t, stateFile, &clock)
+	timerTick(t, restored, true, phaseLongBreak)
+	if !restored.state.Finished {
+		t.Error("the phase that ended while not running isn't finished")
+	}
+
+	// a broken state file starts over
+	if err := os.WriteFile(stateFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, broken, _ := newTestTimer(t, stateFile, &clock)
+	timerCommand(t, broken, "work 25:00 paused", "status")
+}
+
+func TestTimerStatePath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	if path, err := timerStatePath(); err != nil || path != "/state/statusbar-sway/timer.json" {
+		t.Errorf("got %q %v", path, err)
+	}
+
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", "/home/user")
+	if path, err := timerStatePath(); err != nil || path != "/home/user/.local/state/statusbar-sway/timer.json" {
+		t.Errorf("got %q %v", path, err)
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                                "0:00",
+		time.Millisecond:                 "0:01",
+		25 * time.Minute:                 "25:00",
+		59*time.Minute + 59*time.Second:  "59:59",
+		90 * time.Minute:                 "1:30:00",
+		10*time.Hour + 5*time.Second - 1: "10:00:05",
+	}
+
+	for remaining, want := range tests {
+		if got := formatRemaining(remaining); got != want {
+			t.Errorf("%s: got %q, want %q", remaining, got, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package widget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// USER_HZ, the unit of the cpu times in /proc/<pid>/stat
+const CLOCK_TICKS = 100
+
+// how long the top process is shown after clicking
+const TOP_PROCESS_TIMEOUT = 5 * time.Second
+
+// how long cpu usage of processes is sampled for
+const TOP_PROCESS_SAMPLE = 1 * time.Second
+
+type processUsage struct {
+	pid     int
+	name    string
+	percent float64
+}
+
+// topProcessView temporarily replaces the text of a widget
+type topProcessView struct {
+	text  string
+	until time.Time
+}
+
+func (v *topProcessView) active() bool {
+	return v.text != "" && time.Now().Before(v.until)
+}
+
+// showTopProcess shows the text in place of the widget, and reverts it after a timeout
+func (w *Widget) showTopProcess(view *topProcessView, text string) {
+	w.block.Lock()
+	view.text = text
+	view.until = time.Now().Add(TOP_PROCESS_TIMEOUT)
+	w.block.Unlock()
+
+	w.sendUpdate()
+	time.AfterFunc(TOP_PROCESS_TIMEOUT, w.sendUpdate)
+}
+
+func (p *processUsage) String() string {
+	return fmt.Sprintf("%s %.1f%%", p.name, p.percent)
+}
+
+// topCpuProcess samples the cpu time of all processes, and returns the one
+// that used the most. 100% is one fully used core, like top
+func topCpuProcess() (*processUsage, error) {
+	before := readProcessTimes()
+	start := time.Now()
+	time.Sleep(TOP_PROCESS_SAMPLE)
+	after := readProcessTimes()
+	elapsed := time.Since(start).Seconds()
+
+	var top *processUsage
+	for pid, times := range after {
+		prev, exists := before[pid]
+		if !exists {
+			continue
+		}
+
+		percent := 100 * float64(times.ticks-prev.ticks) / CLOCK_TICKS / elapsed
+		if top == nil || percent > top.percent {
+			top = &processUsage{pid: pid, name: times.name, percent: percent}
+		}
+	}
+
+	if top == nil {
+		return nil, fmt.Errorf("no processes found")
+	}
+	return top, nil
+}
+
+// topMemoryProcess returns the process with the largest resident set, as a
+// percentage of total memory
+func topMemoryProcess(memTotal int) (*processUsage, error) {
+	pageSize := os.Getpagesize()
+
+	candidates := make([]*processUsage, 0)
+	// resident pages by pid
+	resident := make(map[int]int)
+	for _, pid := range listPids() {
+		// size resident shared text lib data dt, in pages
+		statm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "statm"))
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(string(statm))
+		if len(fields) < 2 {
+			continue
+		}
+
+		resident[pid], _ = strconv.Atoi(fields[1])
+		candidates = append(candidates, &processUsage{pid: pid})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return resident[candidates[i].pid] > resident[candidates[j].pid]
+	})
+
+	// the largest process may exit before its name is read
+	for _, top := range candidates {
+		stat := readProcessStat(top.pid)
+		if stat == nil {
+			continue
+		}
+
+		top.name = stat.name
+		if memTotal > 0 {
+			// memTotal is in kB
+			top.percent = 100 * float64(resident[top.pid]*pageSize/1024) / float64(memTotal)
+		}
+		return top, nil
+	}
+
+	return nil, fmt.Errorf("no processes found")
+}
+
+type processTimes struct {
+	name  string
+	ticks int
+}
+
+func readProcessTimes() map[int]*processTimes {
+	result := make(map[int]*processTimes)
+	for _, pid := range listPids() {
+		if times := readProcessStat(pid); times != nil {
+			result[pid] = times
+		}
+	}
+	return result
+}
+
+// readProcessStat returns the name and utime+stime of a process
+func readProcessStat(pid int) *processTimes {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil
+	}
+
+	// the name is in parentheses and may itself contain spaces and parentheses
+	line := string(stat)
+	nameStart := strings.IndexByte(line, '(')
+	nameEnd := strings.LastIndexByte(line, ')')
+	if nameStart == -1 || nameEnd < nameStart {
+		return nil
+	}
+
+	// fields after the name start at field 3 (state), utime and stime are field 14 and 15
+	fields := strings.Fields(line[nameEnd+1:])
+	if len(fields) < 13 {
+		return nil
+	}
+
+	utime, _ := strconv.Atoi(fields[11])
+	stime, _ := strconv.Atoi(fields[12])
+	return &processTimes{name: line[nameStart+1 : nameEnd], ticks: utime + stime}
+}
+
+func listPids() []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	pids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,27 @@
+package widget
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTopMemoryProcess(t *testing.T) {
+	top, err := topMemoryProcess(16 * 1024 * 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.name == "" || top.percent <= 0 {
+		t.Errorf("got %+v", top)
+	}
+}
+
+func TestReadProcessStat(t *testing.T) {
+	if stat := readProcessStat(os.Getpid()); stat == nil || stat.name == "" {
+		t.Errorf("got %+v for the test process", stat)
+	}
+
+	// processes that have exited can't be read
+	if stat := readProcessStat(-1); stat != nil {
+		t.Errorf("got %+v for a missing process", stat)
+	}
+}
@@ -2,135 +2,529 @@ package widget
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/rand"
 	"net/http"
-	"strings"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/haakonleg/statusbar-sway/util"
 )
 
-const API_URL = "https://api.met.no/weatherapi/nowcast/2.0/complete?lat=%f&lon=%f"
-const BROWSER_URL = "https://www.yr.no/nb/værvarsel/daglig-tabell/%f,%f"
+const BROWSER_URL = "https://www.yr.no/nb/værvarsel/daglig-tabell/%.4f,%.4f"
 
-var weatherIcon = map[string][]rune{
-	"clearsky": {'', ''}, // nf-weather
-	"cloudy":   {'', ''},
-	"fair":     {'', ''},
-	"fog":      {'', ''},
-	"rain":     {'', '', '', ''},
-	"sleet":    {'', '', '', ''},
-	"snow":     {'', '', '', ''},
-}
+// nf-md-umbrella
+const ICON_UMBRELLA = '󰕊'
 
-type yrWeatherData struct {
-	time           time.Time
-	airTemperature float64
-	windSpeed      float64
-	symbolCode     string
-}
+// nf-md-alert
+const ICON_ALERT = '󰀦'
 
-type Weather struct {
-	*Widget
+// met.no requires an identifying user agent
+const WEATHER_USER_AGENT = "statusbar-sway github.com/haakonleg/statusbar-sway"
+
+// used when the response has no expiry, or fetching fails
+const WEATHER_DEFAULT_INTERVAL = 5 * time.Minute
+
+// backoff when the api responds with 429 or 5xx
+const WEATHER_MIN_BACKOFF = 1 * time.Minute
+const WEATHER_MAX_BACKOFF = 1 * time.Hour
 
+type TemperatureUnit int
+
+const (
+	TemperatureCelsius TemperatureUnit = iota
+	TemperatureFahrenheit
+)
+
+type WindUnit int
+
+const (
+	WindMetersPerSecond WindUnit = iota
+	WindKilometersPerHour
+)
+
+type WeatherProvider int
+
+const (
+	// met.no locationforecast, global coverage
+	WeatherLocationforecast WeatherProvider = iota
+	// met.no nowcast, more precise but only covers the Nordic countries
+	WeatherNowcast
+)
+
+type WeatherConfig struct {
+	// location of the forecast, defaults to Oslo
 	Lat float64
 	Lon float64
 
-	weatherData     *yrWeatherData
+	TemperatureUnit TemperatureUnit
+	WindUnit        WindUnit
+	// Icons is the icon set used for the weather symbols, defaults to Nerd Font
+	Icons WeatherIcons
+	// details shown after the current temperature
+	ShowWind          bool
+	ShowPrecipitation bool
+	ShowHumidity      bool
+	// ShowFeelsLike shows the wind chill or heat index
+	ShowFeelsLike bool
+
+	// Provider is the weather api used, defaults to locationforecast
+	Provider WeatherProvider
+
+	// Geoclue gets the location from GeoClue, Lat and Lon are used until it is known
+	Geoclue bool
+	// DistanceThreshold is how far in meters the location must move before the
+	// forecast is refetched, defaults to 5000
+	DistanceThreshold int
+	// PrecipitationWarning sets the widget urgent when precipitation starts within
+	// this many minutes, requires the nowcast provider
+	PrecipitationWarning int
+	// Alerts shows severe weather alerts from MetAlerts, which only covers Norway
+	Alerts bool
+
+	// Geocoder is a Nominatim compatible api used to show the name of the location,
+	// e.g. https://nominatim.openstreetmap.org
+	Geocoder string
+}
+
+type weatherView int
+
+const (
+	viewCurrent weatherView = iota
+	viewNext6Hours
+	viewTomorrow
+	viewCount
+)
+
+type Weather struct {
+	*Widget
+	config   WeatherConfig
+	provider weatherProvider
+	// changed by clicking
+	view weatherView
+
+	location        weatherLocation
+	place           string
+	geoclue         *geoclueClient
+	locationChannel chan weatherLocation
+
+	forecast      *weatherForecast
+	alerts        []*weatherAlert
+	alertsBaseUrl string
+	// raw response of the forecast, for the cache
+	body            string
+	lastModified    string
 	expireTimestamp time.Time
+	backoff         time.Duration
+}
+
+// weatherStatusError is an unsuccessful response from the weather api
+type weatherStatusError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *weatherStatusError) Error() string {
+	return fmt.Sprintf("invalid status code: %d", e.statusCode)
 }
 
-func NewWeatherWidget() *Widget {
-	return newWidget("weather", -1, func(widget *Widget) impl {
+func NewWeatherWidget(config WeatherConfig) *Widget {
+	if config.Lat == 0 && config.Lon == 0 {
+		config.Lat = 59.91
+		config.Lon = 10.75
+	}
+	if config.DistanceThreshold == 0 {
+		config.DistanceThreshold = 5000
+	}
+
+	var provider weatherProvider
+	switch config.Provider {
+	case WeatherNowcast:
+		provider = newNowcastProvider()
+	default:
+		provider = newLocationforecastProvider()
+	}
+
+	// the forecast is only fetched every few minutes, but the countdown to
+	// precipitation changes every minute
+	interval := -1
+	if config.PrecipitationWarning > 0 {
+		interval = 60000
+	}
+
+	return newWidget("weather", interval, func(widget *Widget) impl {
 		return &Weather{
-			Widget: widget,
-			Lat:    59.91,
-			Lon:    10.75,
+			Widget:          widget,
+			config:          config,
+			provider:        provider,
+			alertsBaseUrl:   MET_NO_URL,
+			location:        weatherLocation{lat: config.Lat, lon: config.Lon},
+			locationChannel: make(chan weatherLocation, 1),
 		}
 	})
 }
 
-func (w *Weather) setup() {}
+// start geoclue and load the cached forecast, if it is for the same request
+func (w *Weather) setup() {
+	if w.config.Geoclue {
+		if geoclue, err := newGeoclueClient(w.config.DistanceThreshold); err != nil {
+			log.Printf("GeoClue not available, using the configured location: %s", err.Error())
+		} else {
+			w.geoclue = geoclue
+		}
+	}
+
+	cache, err := readWeatherCache()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read weather cache: %s", err.Error())
+		}
+		return
+	}
 
-func (w *Weather) close() {}
+	// the last known location, until geoclue finds the current one
+	if w.geoclue != nil && (cache.Lat != 0 || cache.Lon != 0) {
+		w.location = weatherLocation{lat: cache.Lat, lon: cache.Lon}
+	}
+
+	req, err := w.provider.request(w.location.lat, w.location.lon)
+	if err != nil || cache.Url != req.URL.String() {
+		return
+	}
+
+	if forecast, err := w.provider.parse([]byte(cache.Body)); err != nil {
+		log.Printf("failed to parse weather cache: %s", err.Error())
+	} else {
+		w.forecast = forecast
+		w.body = cache.Body
+		w.lastModified = cache.LastModified
+		w.expireTimestamp = cache.Expires
+		w.place = cache.Place
+	}
+}
+
+func (w *Weather) close() {
+	if w.geoclue != nil {
+		w.geoclue.close()
+	}
+}
 
 func (w *Weather) run() {
+	if w.geoclue != nil {
+		go w.geoclue.run(w.locationChannel)
+	}
+
+	if w.forecast != nil {
+		w.sendUpdate()
+	}
+	if w.config.Geocoder != "" && w.place == "" {
+		w.updatePlace()
+	}
+
 	for {
-		data, err := w.fetchWeatherData()
+		// the cached forecast may still be valid
+		if time.Now().Before(w.expireTimestamp) {
+			w.sleep(time.Until(w.expireTimestamp) + weatherJitter())
+			if time.Now().Before(w.expireTimestamp) {
+				// woken up by a location change
+				continue
+			}
+		}
+
+		forecast, err := w.fetchWeatherData()
 		if err != nil {
 			log.Printf("failed to fetch weather data: %s", err.Error())
-		} else {
-			w.weatherData = data
-			w.sendUpdate()
+			w.sleep(w.retryDelay(err))
+			continue
 		}
 
-		delay := time.Duration(rand.Intn(120)+30) * time.Second
-		if !w.expireTimestamp.IsZero() {
-			time.Sleep(time.Until(w.expireTimestamp) + delay)
-		} else {
-			time.Sleep((5 * time.Minute) + delay)
+		w.backoff = 0
+		w.block.Lock()
+		w.forecast = forecast
+		w.block.Unlock()
+		if w.config.Alerts {
+			w.updateAlerts()
+		}
+		w.sendUpdate()
+
+		if !time.Now().Before(w.expireTimestamp) {
+			w.sleep(WEATHER_DEFAULT_INTERVAL + weatherJitter())
 		}
 	}
 }
 
-func (w *Weather) update(block *block) {
-	if w.weatherData != nil {
-		symbolCode := w.weatherData.symbolCode
+// sleep waits for a duration, or until the location changes
+func (w *Weather) sleep(duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
-		icon := ' '
-		iconIndex := 0
-		hour := w.weatherData.time.Hour()
-		if hour < 8 || hour > 20 {
-			iconIndex = 1
-		}
+	select {
+	case <-timer.C:
+	case location := <-w.locationChannel:
+		w.setLocation(location)
+	}
+}
 
-		if strings.Contains(symbolCode, "thunder") {
-			iconIndex += 2
-		}
+// setLocation invalidates the forecast if the location moved far enough
+func (w *Weather) setLocation(location weatherLocation) {
+	if location.distance(w.location) < float64(w.config.DistanceThreshold) {
+		return
+	}
 
-		if strings.Contains(symbolCode, "clearsky") {
-			icon = weatherIcon["clearsky"][iconIndex]
-		} else if strings.Contains(symbolCode, "cloudy") {
-			icon = weatherIcon["cloudy"][iconIndex]
-		} else if strings.Contains(symbolCode, "fair") {
-			icon = weatherIcon["fair"][iconIndex]
-		} else if strings.Contains(symbolCode, "fog") {
-			icon = weatherIcon["fog"][iconIndex]
-		} else if strings.Contains(symbolCode, "rain") {
-			icon = weatherIcon["rain"][iconIndex]
-		} else if strings.Contains(symbolCode, "sleet") {
-			icon = weatherIcon["sleet"][iconIndex]
-		} else if strings.Contains(symbolCode, "snow") {
-			icon = weatherIcon["snow"][iconIndex]
-		}
+	log.Printf("location changed to %.4f, %.4f", location.lat, location.lon)
+	w.block.Lock()
+	w.location = location
+	w.place = ""
+	w.block.Unlock()
+
+	w.lastModified = ""
+	w.expireTimestamp = time.Time{}
 
-		block.FullText = fmt.Sprintf("%c  %.1f°C", icon, w.weatherData.airTemperature)
+	if w.config.Geocoder != "" {
+		w.updatePlace()
+	}
+}
+
+func (w *Weather) updatePlace() {
+	if place, err := lookupPlace(w.config.Geocoder, w.location); err != nil {
+		log.Printf("failed to look up place name: %s", err.Error())
+	} else {
+		w.block.Lock()
+		w.place = place
+		w.block.Unlock()
+		w.sendUpdate()
+	}
+}
+
+func (w *Weather) updateAlerts() {
+	if alerts, err := fetchAlerts(w.alertsBaseUrl, w.location); err != nil {
+		log.Printf("failed to fetch weather alerts: %s", err.Error())
 	} else {
+		w.block.Lock()
+		w.alerts = alerts
+		w.block.Unlock()
+	}
+}
+
+// mostSevereAlert returns the active alert with the highest awareness level
+func (w *Weather) mostSevereAlert() *weatherAlert {
+	var mostSevere *weatherAlert
+	for _, alert := range w.alerts {
+		if mostSevere == nil || alert.severity() > mostSevere.severity() {
+			mostSevere = alert
+		}
+	}
+	return mostSevere
+}
+
+// retryDelay backs off exponentially when the api is overloaded or failing
+func (w *Weather) retryDelay(err error) time.Duration {
+	var statusErr *weatherStatusError
+	if !errors.As(err, &statusErr) || (statusErr.statusCode != http.StatusTooManyRequests && statusErr.statusCode < 500) {
+		return WEATHER_DEFAULT_INTERVAL + weatherJitter()
+	}
+
+	if w.backoff == 0 {
+		w.backoff = WEATHER_MIN_BACKOFF
+	} else if w.backoff *= 2; w.backoff > WEATHER_MAX_BACKOFF {
+		w.backoff = WEATHER_MAX_BACKOFF
+	}
+
+	if statusErr.retryAfter > w.backoff {
+		return statusErr.retryAfter
+	}
+	return w.backoff + weatherJitter()
+}
+
+// weatherJitter spreads requests, as asked by the met.no terms of service
+func weatherJitter() time.Duration {
+	return time.Duration(rand.Intn(120)+30) * time.Second
+}
+
+func (w *Weather) update(block *block) {
+	if w.forecast == nil {
 		block.FullText = ""
+		return
+	}
+
+	text := w.formatView(w.view)
+	if text == "" {
+		// the forecast no longer covers the view
+		w.view = viewCurrent
+		text = w.formatView(w.view)
 	}
+
+	if w.place != "" {
+		text = w.place + " " + text
+	}
+
+	block.Color = ""
+	block.Urgent = false
+
+	if w.config.PrecipitationWarning > 0 {
+		within := time.Duration(w.config.PrecipitationWarning) * time.Minute
+		if start, ok := w.forecast.precipitationStart(within); ok {
+			text += fmt.Sprintf(" %c %.0fmin", ICON_UMBRELLA, start.Minutes())
+			block.Urgent = true
+		}
+	}
+
+	if alert := w.mostSevereAlert(); alert != nil {
+		text += fmt.Sprintf(" %c %s", ICON_ALERT, alert.event)
+		block.Color = COLOR_WARNING
+		if alert.severity() >= 2 {
+			block.Urgent = true
+		}
+	}
+
+	block.FullText = text
 }
 
-// opens weather in browser
+// left click cycles through the current conditions and forecasts,
+// right click opens the most severe alert, or the weather in the browser
 func (w *Weather) onClick(x int, y int, btn int) {
 	if btn == 1 {
-		util.OpenBrowser(fmt.Sprintf(BROWSER_URL, w.Lat, w.Lon))
+		// the forecast is replaced by run, and the view is reset by update
+		w.block.Lock()
+		hasForecast := w.forecast != nil
+		if hasForecast {
+			// skip forecasts not available from the provider
+			for view := (w.view + 1) % viewCount; ; view = (view + 1) % viewCount {
+				if view == viewCurrent || w.formatView(view) != "" {
+					w.view = view
+					break
+				}
+			}
+		}
+		w.block.Unlock()
+
+		if hasForecast {
+			w.sendUpdate()
+		}
+	} else if btn == 3 {
+		// the alerts and location are replaced by run, the location when
+		// geoclue reports a new one
+		w.block.Lock()
+		url := fmt.Sprintf(BROWSER_URL, w.location.lat, w.location.lon)
+		if alert := w.mostSevereAlert(); alert != nil {
+			url = alert.url
+		}
+		w.block.Unlock()
+		util.OpenBrowser(url)
+	}
+}
+
+// formatView returns the text of a view, or an empty string if it isn't available
+func (w *Weather) formatView(view weatherView) string {
+	switch view {
+	case viewNext6Hours:
+		current := w.forecast.current()
+		if current.next6Hours == nil {
+			return ""
+		}
+		return "NEXT 6H " + w.formatPeriod(current.next6Hours)
+
+	case viewTomorrow:
+		year, month, day := time.Now().AddDate(0, 0, 1).Date()
+		midday := time.Date(year, month, day, 12, 0, 0, 0, time.Local)
+		tomorrow := w.forecast.day(midday)
+		if tomorrow == nil {
+			return ""
+		}
+		return "TOMORROW " + w.formatPeriod(tomorrow)
+
+	default:
+		return w.formatCurrent(w.forecast.current())
 	}
 }
 
-func (w *Weather) fetchWeatherData() (*yrWeatherData, error) {
+func (w *Weather) formatCurrent(current *weatherData) string {
+	text := fmt.Sprintf("%s  %s", weatherIcon(w.config.Icons, current.symbolCode), w.formatTemperature(current.airTemperature))
+
+	if w.config.ShowFeelsLike {
+		text += " feels " + w.formatTemperature(feelsLike(current))
+	}
+	if w.config.ShowWind {
+		text += fmt.Sprintf(" %s %s", w.formatWind(current.windSpeed), windArrow(current.windDirection))
+	}
+	if w.config.ShowPrecipitation {
+		text += fmt.Sprintf(" %.1fmm", current.precipitation)
+	}
+	if w.config.ShowHumidity {
+		text += fmt.Sprintf(" %.0f%%", current.humidity)
+	}
+
+	return text
+}
+
+func (w *Weather) formatPeriod(period *weatherPeriod) string {
+	return fmt.Sprintf("%s  %s/%s %.1fmm", weatherIcon(w.config.Icons, period.symbolCode),
+		w.formatTemperature(period.minTemperature), w.formatTemperature(period.maxTemperature), period.precipitation)
+}
+
+// windArrow returns an arrow pointing in the direction the wind is blowing
+func windArrow(fromDirection float64) string {
+	arrows := []string{"↓", "↙", "←", "↖", "↑", "↗", "→", "↘"}
+	return arrows[int(math.Round(fromDirection/45))%len(arrows)]
+}
+
+// feelsLike returns the wind chill below 10°C and the heat index above 27°C,
+// otherwise the air temperature
+func feelsLike(data *weatherData) float64 {
+	celsius := data.airTemperature
+	windKmh := data.windSpeed * 3.6
+
+	if celsius <= 10 && windKmh > 4.8 {
+		v := math.Pow(windKmh, 0.16)
+		return 13.12 + 0.6215*celsius - 11.37*v + 0.3965*celsius*v
+	} else if celsius >= 27 && data.humidity > 0 {
+		// the Rothfusz regression, in °F
+		t := celsius*9/5 + 32
+		rh := data.humidity
+		index := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		return (index - 32) * 5 / 9
+	}
+
+	return celsius
+}
+
+// formatTemperature formats °C in the configured unit
+func (w *Weather) formatTemperature(celsius float64) string {
+	if w.config.TemperatureUnit == TemperatureFahrenheit {
+		return fmt.Sprintf("%.1f°F", celsius*9/5+32)
+	}
+	return fmt.Sprintf("%.1f°C", celsius)
+}
+
+// formatWind formats m/s in the configured unit
+func (w *Weather) formatWind(speed float64) string {
+	if w.config.WindUnit == WindKilometersPerHour {
+		return fmt.Sprintf("%.0fkm/h", speed*3.6)
+	}
+	return fmt.Sprintf("%.1fm/s", speed)
+}
+
+// fetchWeatherData fetches the forecast if it was modified since the last request
+func (w *Weather) fetchWeatherData() (*weatherForecast, error) {
 	log.Println("fetching new weather data")
 	client := &http.Client{}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf(API_URL, w.Lat, w.Lon), nil)
+	req, err := w.provider.request(w.location.lat, w.location.lon)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Accept-Encoding", "gzip")
-	req.Header.Set("User-Agent", "gopher")
+	req.Header.Set("User-Agent", WEATHER_USER_AGENT)
+	if w.lastModified != "" && w.forecast != nil {
+		req.Header.Set("If-Modified-Since", w.lastModified)
+	}
 
 	res, err := client.Do(req)
 	if err != nil {
@@ -138,10 +532,27 @@ func (w *Weather) fetchWeatherData() (*yrWeatherData, error) {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == 304 {
-		// not modified
-		return w.weatherData, nil
-	} else if res.StatusCode == 200 {
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified {
+		statusErr := &weatherStatusError{statusCode: res.StatusCode}
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			statusErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, statusErr
+	}
+
+	expires := res.Header.Get("Expires")
+	if expires != "" {
+		if expireTimestamp, err := http.ParseTime(expires); err != nil {
+			return nil, fmt.Errorf("error parsing expires header: %s", err.Error())
+		} else {
+			w.expireTimestamp = expireTimestamp
+		}
+	}
+
+	forecast := w.forecast
+	if res.StatusCode == http.StatusNotModified {
+		log.Println("weather data not modified")
+	} else {
 		reader := res.Body
 
 		encoding := res.Header.Get("Content-Encoding")
@@ -154,54 +565,33 @@ func (w *Weather) fetchWeatherData() (*yrWeatherData, error) {
 			}
 		}
 
-		expires := res.Header.Get("Expires")
-		if expires != "" {
-			if expireTimestamp, err := http.ParseTime(expires); err != nil {
-				return nil, fmt.Errorf("error parsing expires header: %s", err.Error())
-			} else {
-				w.expireTimestamp = expireTimestamp
-			}
-		}
-
 		body, err := io.ReadAll(reader)
 		if err != nil {
 			return nil, err
 		}
 
-		weatherData, err := parseWeatherData(body)
+		forecast, err = w.provider.parse(body)
 		if err != nil {
 			return nil, err
 		}
 
-		log.Printf("got weather data:\n%+v", weatherData)
-
-		return weatherData, nil
-	} else {
-		return nil, fmt.Errorf("invalid status code: %d", res.StatusCode)
+		w.body = string(body)
+		w.lastModified = res.Header.Get("Last-Modified")
+		log.Printf("got weather data:\n%+v", forecast.timeseries[0])
 	}
-}
 
-func parseWeatherData(input []byte) (*yrWeatherData, error) {
-	node, err := util.NewJsonNode(input)
-	if err != nil {
-		return nil, err
+	cache := &weatherCache{
+		Url:          req.URL.String(),
+		Lat:          w.location.lat,
+		Lon:          w.location.lon,
+		Place:        w.place,
+		LastModified: w.lastModified,
+		Expires:      w.expireTimestamp,
+		Body:         w.body,
 	}
-
-	timeseries := node.Get("properties").Get("timeseries").Index(0)
-	timeStr := timeseries.Get("time").String()
-	time, err := time.Parse(time.RFC3339, timeStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse timestamp %s", timeStr)
+	if err := writeWeatherCache(cache); err != nil {
+		log.Printf("failed to write weather cache: %s", err.Error())
 	}
 
-	data := timeseries.Get("data")
-	details := data.Get("instant").Get("details")
-	summary := data.Get("next_1_hours").Get("summary")
-
-	return &yrWeatherData{
-		time:           time,
-		airTemperature: details.Get("air_temperature").Number(),
-		windSpeed:      details.Get("wind_speed").Number(),
-		symbolCode:     summary.Get("symbol_code").String(),
-	}, nil
+	return forecast, nil
 }
@@ -0,0 +1,104 @@
+package widget
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+// used when an alert has no link of its own
+const ALERTS_BROWSER_URL = "https://www.yr.no/nb/farevarsler"
+
+// weatherAlert is an active MetAlerts warning
+type weatherAlert struct {
+	event string
+	title string
+	// yellow, orange or red
+	level string
+	url   string
+}
+
+// severity orders alerts by awareness level
+func (a *weatherAlert) severity() int {
+	switch a.level {
+	case "red":
+		return 3
+	case "orange":
+		return 2
+	case "yellow":
+		return 1
+	}
+	return 0
+}
+
+// fetchAlerts fetches the active alerts for a location from MetAlerts, which only covers Norway
+func fetchAlerts(baseUrl string, location weatherLocation) ([]*weatherAlert, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	url := fmt.Sprintf("%s/metalerts/2.0/current.json?lat=%.4f&lon=%.4f", baseUrl, location.lat, location.lon)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", WEATHER_USER_AGENT)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid status code: %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAlerts(body)
+}
+
+// parseAlerts parses the GeoJSON feature collection of alerts
+func parseAlerts(input []byte) ([]*weatherAlert, error) {
+	node, err := util.NewJsonNode(input)
+	if err != nil {
+		return nil, err
+	} else if !node.IsObject || !node.Get("features").IsArray {
+		return nil, fmt.Errorf("no features in response")
+	}
+
+	alerts := make([]*weatherAlert, 0)
+	for _, feature := range node.Get("features").Array() {
+		properties := optionalObject(feature, "properties")
+		if properties == nil {
+			continue
+		}
+
+		alert := &weatherAlert{
+			event: optionalString(properties, "eventAwarenessName"),
+			title: optionalString(properties, "title"),
+			url:   optionalString(properties, "web"),
+		}
+		if alert.event == "" {
+			alert.event = optionalString(properties, "event")
+		}
+		if alert.url == "" {
+			alert.url = ALERTS_BROWSER_URL
+		}
+
+		// e.g. 2; yellow; Moderate
+		if fields := strings.Split(optionalString(properties, "awareness_level"), ";"); len(fields) > 1 {
+			alert.level = strings.ToLower(strings.TrimSpace(fields[1]))
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
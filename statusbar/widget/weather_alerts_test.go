@@ -0,0 +1,46 @@
+package widget
+
+import "testing"
+
+func TestParseAlerts(t *testing.T) {
+	alerts, err := parseAlerts([]byte(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {
+			"event": "wind",
+			"eventAwarenessName": "Kraftige vindkast",
+			"title": "Kraftige vindkast, gult nivå, Oslo",
+			"awareness_level": "2; yellow; Moderate",
+			"web": "https://www.met.no/vaer-og-klima/ekstremvaervarsler-og-andre-farevarsler"
+		}},
+		{"type": "Feature", "properties": {"event": "forestFire", "awareness_level": "3; orange; Severe"}},
+		"invalid",
+		{"type": "Feature", "properties": []}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2", len(alerts))
+	}
+	if alert := alerts[0]; alert.event != "Kraftige vindkast" || alert.level != "yellow" ||
+		alert.url != "https://www.met.no/vaer-og-klima/ekstremvaervarsler-og-andre-farevarsler" {
+		t.Errorf("got %+v", alert)
+	}
+	// the event type and the default link without awareness names and links
+	if alert := alerts[1]; alert.event != "forestFire" || alert.level != "orange" || alert.url != ALERTS_BROWSER_URL {
+		t.Errorf("got %+v", alert)
+	}
+
+	weather := &Weather{alerts: alerts}
+	if mostSevere := weather.mostSevereAlert(); mostSevere != alerts[1] {
+		t.Errorf("got %+v, want the orange alert", mostSevere)
+	}
+}
+
+func TestParseAlertsMalformed(t *testing.T) {
+	for _, input := range []string{`[]`, `{"features": {}}`, `{`} {
+		if _, err := parseAlerts([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package widget
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// weatherCache is the last successful response, stored so the forecast is
+// shown immediately after a restart and not refetched until it expires
+type weatherCache struct {
+	Url          string    `json:"url"`
+	Lat          float64   `json:"lat"`
+	Lon          float64   `json:"lon"`
+	Place        string    `json:"place"`
+	LastModified string    `json:"last_modified"`
+	Expires      time.Time `json:"expires"`
+	Body         string    `json:"body"`
+}
+
+// weatherCachePath returns the cache file under $XDG_CACHE_HOME, or ~/.cache
+func weatherCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "statusbar-sway", "weather.json"), nil
+}
+
+func readWeatherCache() (*weatherCache, error) {
+	path, err := weatherCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &weatherCache{}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func writeWeatherCache(cache *weatherCache) error {
+	path, err := weatherCachePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write and rename, so a crash never leaves a truncated cache
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,162 @@
+package widget
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+const GEOCLUE_SERVICE = "org.freedesktop.GeoClue2"
+const GEOCLUE_MANAGER = "/org/freedesktop/GeoClue2/Manager"
+
+// GClueAccuracyLevel, city level is plenty for a forecast
+const GEOCLUE_ACCURACY_CITY = 4
+
+type weatherLocation struct {
+	lat float64
+	lon float64
+}
+
+// distance returns the great-circle distance to another location in meters
+func (l weatherLocation) distance(other weatherLocation) float64 {
+	const earthRadius = 6371000
+
+	lat1 := l.lat * math.Pi / 180
+	lat2 := other.lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (other.lon - l.lon) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// geoclueClient receives location updates from GeoClue over the system bus
+type geoclueClient struct {
+	dbus    *dbus.Conn
+	client  dbus.BusObject
+	signals chan *dbus.Signal
+}
+
+func newGeoclueClient(distanceThreshold int) (*geoclueClient, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &geoclueClient{
+		dbus:    conn,
+		signals: make(chan *dbus.Signal, 10),
+	}
+	if err := g.start(distanceThreshold); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *geoclueClient) start(distanceThreshold int) error {
+	var clientPath dbus.ObjectPath
+	manager := g.dbus.Object(GEOCLUE_SERVICE, GEOCLUE_MANAGER)
+	if err := manager.Call("org.freedesktop.GeoClue2.Manager.GetClient", 0).Store(&clientPath); err != nil {
+		return err
+	}
+	g.client = g.dbus.Object(GEOCLUE_SERVICE, clientPath)
+
+	// geoclue refuses to start clients that don't identify themselves
+	properties := map[string]any{
+		"DesktopId":              "statusbar-sway",
+		"DistanceThreshold":      uint32(distanceThreshold),
+		"RequestedAccuracyLevel": uint32(GEOCLUE_ACCURACY_CITY),
+	}
+	for name, value := range properties {
+		if err := g.client.SetProperty("org.freedesktop.GeoClue2.Client."+name, dbus.MakeVariant(value)); err != nil {
+			return fmt.Errorf("failed to set %s: %s", name, err.Error())
+		}
+	}
+
+	if err := g.dbus.AddMatchSignal(
+		dbus.WithMatchObjectPath(clientPath),
+		dbus.WithMatchInterface("org.freedesktop.GeoClue2.Client"),
+		dbus.WithMatchMember("LocationUpdated"),
+	); err != nil {
+		return err
+	}
+	g.dbus.Signal(g.signals)
+
+	return g.client.Call("org.freedesktop.GeoClue2.Client.Start", 0).Err
+}
+
+func (g *geoclueClient) close() {
+	g.client.Call("org.freedesktop.GeoClue2.Client.Stop", 0)
+	g.dbus.Close()
+}
+
+// run sends the new location whenever geoclue reports one
+func (g *geoclueClient) run(locationChannel chan<- weatherLocation) {
+	for signal := range g.signals {
+		// LocationUpdated(old, new)
+		if len(signal.Body) < 2 {
+			continue
+		}
+		path, ok := signal.Body[1].(dbus.ObjectPath)
+		if !ok {
+			continue
+		}
+
+		location := g.dbus.Object(GEOCLUE_SERVICE, path)
+		lat, err := location.GetProperty("org.freedesktop.GeoClue2.Location.Latitude")
+		if err != nil {
+			continue
+		}
+		lon, err := location.GetProperty("org.freedesktop.GeoClue2.Location.Longitude")
+		if err != nil {
+			continue
+		}
+
+		latValue, latOk := lat.Value().(float64)
+		lonValue, lonOk := lon.Value().(float64)
+		if latOk && lonOk {
+			locationChannel <- weatherLocation{lat: latValue, lon: lonValue}
+		}
+	}
+}
+
+// lookupPlace returns the name of the place at a location, using a Nominatim compatible api
+func lookupPlace(geocoder string, location weatherLocation) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	url := fmt.Sprintf("%s/reverse?format=jsonv2&zoom=10&lat=%.4f&lon=%.4f", geocoder, location.lat, location.lon)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", WEATHER_USER_AGENT)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("invalid status code: %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	node, err := util.NewJsonNode(body)
+	if err != nil {
+		return "", err
+	} else if !node.IsObject || !node.Get("name").IsString {
+		return "", fmt.Errorf("no place name in response")
+	}
+	return node.Get("name").String(), nil
+}
@@ -0,0 +1,262 @@
+package widget
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/haakonleg/statusbar-sway/util"
+)
+
+const MET_NO_URL = "https://api.met.no/weatherapi"
+
+// weatherProvider is a weather api. fetching, caching and backoff is handled by
+// the widget, a provider only needs to know how to ask for and parse a forecast
+type weatherProvider interface {
+	// request creates the request for the forecast at a location
+	request(lat float64, lon float64) (*http.Request, error)
+	// parse parses a successful response
+	parse(body []byte) (*weatherForecast, error)
+}
+
+// weatherForecast is a forecast in metric units, ordered by time
+type weatherForecast struct {
+	timeseries []*weatherData
+}
+
+type weatherData struct {
+	time time.Time
+	// °C
+	airTemperature float64
+	// m/s
+	windSpeed float64
+	// degrees, the direction the wind is coming from
+	windDirection float64
+	// percent
+	humidity float64
+	// the summary of the shortest period available
+	symbolCode string
+	// mm in the next hour
+	precipitation float64
+	// mm/h, only provided by nowcast
+	precipitationRate float64
+	// summary of the next six hours, if provided
+	next6Hours *weatherPeriod
+}
+
+// weatherPeriod is the summary of a forecast period
+type weatherPeriod struct {
+	symbolCode     string
+	minTemperature float64
+	maxTemperature float64
+	// mm
+	precipitation float64
+}
+
+// current returns the latest entry that isn't in the future
+func (f *weatherForecast) current() *weatherData {
+	current := f.timeseries[0]
+	now := time.Now()
+	for _, data := range f.timeseries {
+		if data.time.After(now) {
+			break
+		}
+		current = data
+	}
+	return current
+}
+
+// precipitationStart returns how long until precipitation starts, if it isn't
+// already precipitating and starts within a duration
+func (f *weatherForecast) precipitationStart(within time.Duration) (time.Duration, bool) {
+	current := f.current()
+	if current.precipitationRate > 0 {
+		return 0, false
+	}
+
+	now := time.Now()
+	for _, data := range f.timeseries {
+		if !data.time.After(current.time) {
+			continue
+		} else if data.time.After(now.Add(within)) {
+			break
+		}
+
+		if data.precipitationRate > 0 {
+			return data.time.Sub(now), true
+		}
+	}
+
+	return 0, false
+}
+
+// day returns the summary of the local day of t, or nil if the forecast
+// doesn't cover all of it
+func (f *weatherForecast) day(t time.Time) *weatherPeriod {
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	end := start.AddDate(0, 0, 1)
+	midday := start.Add(12 * time.Hour)
+
+	if len(f.timeseries) == 0 || f.timeseries[len(f.timeseries)-1].time.Before(end.Add(-time.Hour)) {
+		return nil
+	}
+
+	var period *weatherPeriod
+	for _, data := range f.timeseries {
+		if data.time.Before(start) || !data.time.Before(end) {
+			continue
+		}
+
+		if period == nil {
+			period = &weatherPeriod{minTemperature: data.airTemperature, maxTemperature: data.airTemperature}
+		} else if data.airTemperature < period.minTemperature {
+			period.minTemperature = data.airTemperature
+		} else if data.airTemperature > period.maxTemperature {
+			period.maxTemperature = data.airTemperature
+		}
+
+		// the summary of the period starting at midday, or the latest before it
+		if !data.time.After(midday) || period.symbolCode == "" {
+			period.symbolCode = data.symbolCode
+			if data.next6Hours != nil {
+				period.symbolCode = data.next6Hours.symbolCode
+			}
+		}
+		// tomorrow is always within the hourly part of the forecast
+		period.precipitation += data.precipitation
+	}
+
+	return period
+}
+
+// metNoProvider uses the forecast products of the Norwegian Meteorological
+// Institute, which share the same response format. locationforecast is global,
+// nowcast only covers the Nordic countries
+type metNoProvider struct {
+	baseUrl string
+	product string
+}
+
+func newLocationforecastProvider() *metNoProvider {
+	return &metNoProvider{baseUrl: MET_NO_URL, product: "locationforecast"}
+}
+
+func newNowcastProvider() *metNoProvider {
+	return &metNoProvider{baseUrl: MET_NO_URL, product: "nowcast"}
+}
+
+func (m *metNoProvider) request(lat float64, lon float64) (*http.Request, error) {
+	// more than 4 decimals is rejected by the api
+	url := fmt.Sprintf("%s/%s/2.0/complete?lat=%.4f&lon=%.4f", m.baseUrl, m.product, lat, lon)
+	return http.NewRequest("GET", url, nil)
+}
+
+func (m *metNoProvider) parse(input []byte) (*weatherForecast, error) {
+	node, err := util.NewJsonNode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := optionalObject(node, "properties")
+	if properties == nil || !properties.Get("timeseries").IsArray {
+		return nil, fmt.Errorf("no timeseries in response")
+	}
+
+	forecast := &weatherForecast{timeseries: make([]*weatherData, 0)}
+	for _, entry := range properties.Get("timeseries").Array() {
+		if !entry.IsObject {
+			continue
+		}
+
+		timeStr := optionalString(entry, "time")
+		time, err := time.Parse(time.RFC3339, timeStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp %s", timeStr)
+		}
+
+		data := optionalObject(entry, "data")
+		details := optionalObject(optionalObject(data, "instant"), "details")
+		if details == nil {
+			continue
+		}
+
+		weather := &weatherData{
+			time:           time,
+			airTemperature: optionalNumber(details, "air_temperature"),
+			windSpeed:      optionalNumber(details, "wind_speed"),
+			windDirection:  optionalNumber(details, "wind_from_direction"),
+			humidity:       optionalNumber(details, "relative_humidity"),
+
+			precipitationRate: optionalNumber(details, "precipitation_rate"),
+		}
+
+		// the last entries of locationforecast only have longer summaries
+		for _, period := range []string{"next_1_hours", "next_6_hours", "next_12_hours"} {
+			if summary := optionalObject(data, period); summary != nil {
+				weather.symbolCode = optionalString(optionalObject(summary, "summary"), "symbol_code")
+				break
+			}
+		}
+
+		if next1Hours := optionalObject(data, "next_1_hours"); next1Hours != nil {
+			weather.precipitation = optionalNumber(optionalObject(next1Hours, "details"), "precipitation_amount")
+		}
+
+		// min and max temperatures are only in the complete forecast
+		if next6Hours := optionalObject(data, "next_6_hours"); next6Hours != nil {
+			details := optionalObject(next6Hours, "details")
+			weather.next6Hours = &weatherPeriod{
+				symbolCode:     optionalString(optionalObject(next6Hours, "summary"), "symbol_code"),
+				minTemperature: optionalNumber(details, "air_temperature_min"),
+				maxTemperature: optionalNumber(details, "air_temperature_max"),
+				precipitation:  optionalNumber(details, "precipitation_amount"),
+			}
+		}
+
+		forecast.timeseries = append(forecast.timeseries, weather)
+	}
+
+	if len(forecast.timeseries) == 0 {
+		return nil, fmt.Errorf("empty timeseries in response")
+	}
+
+	return forecast, nil
+}
+
+// optionalNumber returns the number of a key, or 0 if it is missing. node may be nil
+func optionalNumber(node *util.JsonNode, key string) float64 {
+	if node == nil || !node.IsObject {
+		return 0
+	}
+
+	if value := node.Get(key); value.IsNumber {
+		return value.Number()
+	}
+	return 0
+}
+
+// optionalString returns the string of a key, or an empty string if it is missing. node may be nil
+func optionalString(node *util.JsonNode, key string) string {
+	if node == nil || !node.IsObject {
+		return ""
+	}
+
+	if value := node.Get(key); value.IsString {
+		return value.String()
+	}
+	return ""
+}
+
+// optionalObject returns the object of a key, or nil if it is missing or not
+// an object. node may be nil, so lookups can be chained
+func optionalObject(node *util.JsonNode, key string) *util.JsonNode {
+	if node == nil || !node.IsObject {
+		return nil
+	}
+
+	if value := node.Get(key); value.IsObject {
+		return value
+	}
+	return nil
+}
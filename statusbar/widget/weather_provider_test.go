@@ -0,0 +1,179 @@
+package widget
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// serveFixture serves a fixture as the response of a met.no product
+func serveFixture(t *testing.T, product string, fixture string) *metNoProvider {
+	t.Helper()
+
+	body, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+product+"/2.0/complete" || r.URL.Query().Get("lat") != "59.9139" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return &metNoProvider{baseUrl: server.URL, product: product}
+}
+
+// fetchFixture requests and parses the forecast from a fixture server
+func fetchFixture(t *testing.T, provider *metNoProvider) *weatherForecast {
+	t.Helper()
+
+	req, err := provider.request(59.91391, 10.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	} else if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d for %s", res.StatusCode, req.URL)
+	}
+
+	forecast, err := provider.parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return forecast
+}
+
+func TestMetNoLocationforecast(t *testing.T) {
+	forecast := fetchFixture(t, serveFixture(t, "locationforecast", "testdata/locationforecast.json"))
+
+	if len(forecast.timeseries) != 6 {
+		t.Fatalf("got %d entries, want 6", len(forecast.timeseries))
+	}
+
+	first := forecast.timeseries[0]
+	if !first.time.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) || first.airTemperature != 12 ||
+		first.windSpeed != 3.1 || first.windDirection != 225 || first.humidity != 80.2 {
+		t.Errorf("got %+v", first)
+	}
+	// the summary of the shortest period
+	if first.symbolCode != "clearsky_night" {
+		t.Errorf("symbol %q, want clearsky_night", first.symbolCode)
+	}
+	if first.next6Hours == nil || *first.next6Hours != (weatherPeriod{"fair_day", 11.5, 15, 0.2}) {
+		t.Errorf("next 6 hours %+v", first.next6Hours)
+	}
+
+	if midday := forecast.timeseries[2]; midday.precipitation != 0.8 {
+		t.Errorf("precipitation %.1f, want 0.8", midday.precipitation)
+	}
+	if evening := forecast.timeseries[3]; evening.symbolCode != "cloudy" || evening.precipitation != 0 {
+		t.Errorf("got %+v, want the 6 hour summary without precipitation", evening)
+	}
+	if last := forecast.timeseries[5]; last.symbolCode != "fair_day" || last.next6Hours != nil {
+		t.Errorf("got %+v, want the 12 hour summary", last)
+	}
+}
+
+func TestMetNoLocationforecastDay(t *testing.T) {
+	forecast := fetchFixture(t, serveFixture(t, "locationforecast", "testdata/locationforecast.json"))
+
+	day := forecast.day(time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC))
+	if day == nil {
+		t.Fatal("no summary of a covered day")
+	}
+	if day.minTemperature != 11 || day.maxTemperature != 19.3 {
+		t.Errorf("min %.1f max %.1f, want 11.0 and 19.3", day.minTemperature, day.maxTemperature)
+	}
+	// the 6 hour summary starting at midday
+	if day.symbolCode != "rain" {
+		t.Errorf("symbol %q, want rain", day.symbolCode)
+	}
+	if day.precipitation < 0.899 || day.precipitation > 0.901 {
+		t.Errorf("precipitation %.2f, want 0.9", day.precipitation)
+	}
+
+	if day := forecast.day(time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)); day != nil {
+		t.Errorf("got %+v for a day the forecast doesn't cover", day)
+	}
+}
+
+func TestMetNoNowcast(t *testing.T) {
+	forecast := fetchFixture(t, serveFixture(t, "nowcast", "testdata/nowcast.json"))
+
+	if len(forecast.timeseries) != 5 {
+		t.Fatalf("got %d entries, want 5", len(forecast.timeseries))
+	}
+	if first := forecast.timeseries[0]; first.airTemperature != 18.1 || first.symbolCode != "cloudy" || first.precipitation != 0.4 {
+		t.Errorf("got %+v", first)
+	}
+	if rate := forecast.timeseries[3].precipitationRate; rate != 1.2 {
+		t.Errorf("precipitation rate %.1f, want 1.2", rate)
+	}
+
+	// move the fixture so the first entry is a minute old
+	offset := time.Until(forecast.timeseries[0].time.Add(time.Minute))
+	for _, data := range forecast.timeseries {
+		data.time = data.time.Add(-offset)
+	}
+
+	if start, ok := forecast.precipitationStart(30 * time.Minute); !ok || start < 13*time.Minute || start > 14*time.Minute {
+		t.Errorf("got %s, %t, want rain in 14 minutes", start, ok)
+	}
+	if _, ok := forecast.precipitationStart(10 * time.Minute); ok {
+		t.Error("got rain after the period")
+	}
+
+	// no start when it is already raining
+	forecast.timeseries[0].precipitationRate = 0.5
+	if _, ok := forecast.precipitationStart(30 * time.Minute); ok {
+		t.Error("got a start while it is raining")
+	}
+}
+
+func TestMetNoMalformed(t *testing.T) {
+	provider := newLocationforecastProvider()
+
+	for _, input := range []string{
+		`[]`,
+		`{"properties": []}`,
+		`{"properties": {"timeseries": {}}}`,
+		`{"properties": {"timeseries": [1, "a", null]}}`,
+		`{"properties": {"timeseries": [{"time": 5}]}}`,
+	} {
+		if _, err := provider.parse([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+
+	// entries and periods of the wrong type are skipped
+	forecast, err := provider.parse([]byte(`{"properties": {"timeseries": [
+		[],
+		{"time": "2024-06-01T00:00:00Z", "data": []},
+		{"time": "2024-06-01T01:00:00Z", "data": {"instant": {"details": {"air_temperature": 3}}, "next_1_hours": {"summary": "rain", "details": 5}, "next_6_hours": []}}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast.timeseries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(forecast.timeseries))
+	}
+	if data := forecast.timeseries[0]; data.airTemperature != 3 || data.symbolCode != "" || data.precipitation != 0 || data.next6Hours != nil {
+		t.Errorf("got %+v", data)
+	}
+}
@@ -0,0 +1,153 @@
+package widget
+
+import "strings"
+
+type WeatherIcons int
+
+const (
+	WeatherIconsNerdFont WeatherIcons = iota
+	WeatherIconsEmoji
+	// WeatherIconsText shows a description instead of an icon
+	WeatherIconsText
+)
+
+type weatherCondition int
+
+const (
+	conditionClear weatherCondition = iota
+	conditionFair
+	conditionPartlyCloudy
+	conditionCloudy
+	conditionFog
+	conditionLightRain
+	conditionRain
+	conditionHeavyRain
+	conditionLightRainShowers
+	conditionRainShowers
+	conditionRainThunder
+	conditionRainShowersThunder
+	conditionSleet
+	conditionSleetShowers
+	conditionSleetThunder
+	conditionSnow
+	conditionSnowShowers
+	conditionSnowThunder
+)
+
+type weatherSymbol struct {
+	condition   weatherCondition
+	description string
+}
+
+// weatherSymbols has every met.no symbol code without the _day, _night and
+// _polartwilight suffixes. the misspelled codes are spelled as in the api
+var weatherSymbols = map[string]weatherSymbol{
+	"clearsky":                     {conditionClear, "clear sky"},
+	"fair":                         {conditionFair, "fair"},
+	"partlycloudy":                 {conditionPartlyCloudy, "partly cloudy"},
+	"cloudy":                       {conditionCloudy, "cloudy"},
+	"fog":                          {conditionFog, "fog"},
+	"lightrain":                    {conditionLightRain, "light rain"},
+	"rain":                         {conditionRain, "rain"},
+	"heavyrain":                    {conditionHeavyRain, "heavy rain"},
+	"lightrainshowers":             {conditionLightRainShowers, "light rain showers"},
+	"rainshowers":                  {conditionRainShowers, "rain showers"},
+	"heavyrainshowers":             {conditionRainShowers, "heavy rain showers"},
+	"lightrainandthunder":          {conditionRainThunder, "light rain and thunder"},
+	"rainandthunder":               {conditionRainThunder, "rain and thunder"},
+	"heavyrainandthunder":          {conditionRainThunder, "heavy rain and thunder"},
+	"lightrainshowersandthunder":   {conditionRainShowersThunder, "light rain showers and thunder"},
+	"rainshowersandthunder":        {conditionRainShowersThunder, "rain showers and thunder"},
+	"heavyrainshowersandthunder":   {conditionRainShowersThunder, "heavy rain showers and thunder"},
+	"lightsleet":                   {conditionSleet, "light sleet"},
+	"sleet":                        {conditionSleet, "sleet"},
+	"heavysleet":                   {conditionSleet, "heavy sleet"},
+	"lightsleetshowers":            {conditionSleetShowers, "light sleet showers"},
+	"sleetshowers":                 {conditionSleetShowers, "sleet showers"},
+	"heavysleetshowers":            {conditionSleetShowers, "heavy sleet showers"},
+	"lightsleetandthunder":         {conditionSleetThunder, "light sleet and thunder"},
+	"sleetandthunder":              {conditionSleetThunder, "sleet and thunder"},
+	"heavysleetandthunder":         {conditionSleetThunder, "heavy sleet and thunder"},
+	"lightssleetshowersandthunder": {conditionSleetThunder, "light sleet showers and thunder"},
+	"sleetshowersandthunder":       {conditionSleetThunder, "sleet showers and thunder"},
+	"heavysleetshowersandthunder":  {conditionSleetThunder, "heavy sleet showers and thunder"},
+	"lightsnow":                    {conditionSnow, "light snow"},
+	"snow":                         {conditionSnow, "snow"},
+	"heavysnow":                    {conditionSnow, "heavy snow"},
+	"lightsnowshowers":             {conditionSnowShowers, "light snow showers"},
+	"snowshowers":                  {conditionSnowShowers, "snow showers"},
+	"heavysnowshowers":             {conditionSnowShowers, "heavy snow showers"},
+	"lightsnowandthunder":          {conditionSnowThunder, "light snow and thunder"},
+	"snowandthunder":               {conditionSnowThunder, "snow and thunder"},
+	"heavysnowandthunder":          {conditionSnowThunder, "heavy snow and thunder"},
+	"lightssnowshowersandthunder":  {conditionSnowThunder, "light snow showers and thunder"},
+	"snowshowersandthunder":        {conditionSnowThunder, "snow showers and thunder"},
+	"heavysnowshowersandthunder":   {conditionSnowThunder, "heavy snow showers and thunder"},
+}
+
+// icons of each condition, with the day icon first and the night icon second
+// when they differ. night icons are also used during polar twilight, when the
+// sun stays below the horizon
+var weatherNerdFontIcons = map[weatherCondition][]string{
+	conditionClear:              {"", ""}, // nf-weather-day_sunny, night_clear
+	conditionFair:               {"", ""}, // nf-weather-day_sunny_overcast, night_alt_partly_cloudy
+	conditionPartlyCloudy:       {"", ""}, // nf-weather-day_cloudy, night_alt_cloudy
+	conditionCloudy:             {""},      // nf-weather-cloudy
+	conditionFog:                {""},      // nf-weather-fog
+	conditionLightRain:          {""},      // nf-weather-sprinkle
+	conditionRain:               {""},      // nf-weather-rain
+	conditionHeavyRain:          {""},      // nf-weather-rain_wind
+	conditionLightRainShowers:   {"", ""}, // nf-weather-day_sprinkle, night_alt_sprinkle
+	conditionRainShowers:        {"", ""}, // nf-weather-day_showers, night_alt_showers
+	conditionRainThunder:        {""},      // nf-weather-thunderstorm
+	conditionRainShowersThunder: {"", ""}, // nf-weather-day_storm_showers, night_alt_storm_showers
+	conditionSleet:              {""},      // nf-weather-rain_mix
+	conditionSleetShowers:       {"", ""}, // nf-weather-day_sleet, night_alt_sleet
+	conditionSleetThunder:       {"", ""}, // nf-weather-day_sleet_storm, night_alt_sleet_storm
+	conditionSnow:               {""},      // nf-weather-snow
+	conditionSnowShowers:        {"", ""}, // nf-weather-day_snow, night_alt_snow
+	conditionSnowThunder:        {"", ""}, // nf-weather-day_snow_thunderstorm, night_alt_snow_thunderstorm
+}
+
+var weatherEmojiIcons = map[weatherCondition][]string{
+	conditionClear:              {"☀️", "🌙"},
+	conditionFair:               {"🌤️", "🌙"},
+	conditionPartlyCloudy:       {"⛅", "☁️"},
+	conditionCloudy:             {"☁️"},
+	conditionFog:                {"🌫️"},
+	conditionLightRain:          {"🌧️"},
+	conditionRain:               {"🌧️"},
+	conditionHeavyRain:          {"🌧️"},
+	conditionLightRainShowers:   {"🌦️", "🌧️"},
+	conditionRainShowers:        {"🌦️", "🌧️"},
+	conditionRainThunder:        {"⛈️"},
+	conditionRainShowersThunder: {"⛈️", "⛈️"},
+	conditionSleet:              {"🌨️"},
+	conditionSleetShowers:       {"🌨️", "🌨️"},
+	conditionSleetThunder:       {"⛈️", "⛈️"},
+	conditionSnow:               {"❄️"},
+	conditionSnowShowers:        {"🌨️", "🌨️"},
+	conditionSnowThunder:        {"⛈️", "⛈️"},
+}
+
+// weatherIcon returns the icon of a symbol code, e.g. lightrainshowers_night
+func weatherIcon(iconSet WeatherIcons, symbolCode string) string {
+	name, variant, _ := strings.Cut(symbolCode, "_")
+
+	symbol, exists := weatherSymbols[name]
+	if !exists {
+		return symbolCode
+	} else if iconSet == WeatherIconsText {
+		return symbol.description
+	}
+
+	icons := weatherNerdFontIcons[symbol.condition]
+	if iconSet == WeatherIconsEmoji {
+		icons = weatherEmojiIcons[symbol.condition]
+	}
+
+	if len(icons) > 1 && (variant == "night" || variant == "polartwilight") {
+		return icons[1]
+	}
+	return icons[0]
+}
@@ -0,0 +1,304 @@
+package widget
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLastModified = "Sat, 01 Jun 2024 00:10:00 GMT"
+
+// newTestWeather returns a weather widget fetching from a handler, with the
+// cache in a temporary directory
+func newTestWeather(t *testing.T, handler http.HandlerFunc) *Weather {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	weather := NewWeatherWidget(WeatherConfig{}).impl.(*Weather)
+	weather.provider = &metNoProvider{baseUrl: server.URL, product: "locationforecast"}
+	return weather
+}
+
+func TestWeatherFetchNotModified(t *testing.T) {
+	body, err := os.ReadFile("testdata/locationforecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	weather := newTestWeather(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Expires", "Sat, 01 Jun 2024 00:40:00 GMT")
+		if r.Header.Get("If-Modified-Since") == testLastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Last-Modified", testLastModified)
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(body)
+		gz.Close()
+	})
+
+	forecast, err := weather.fetchWeatherData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast.timeseries) != 6 || weather.lastModified != testLastModified {
+		t.Fatalf("got %d entries, last modified %q", len(forecast.timeseries), weather.lastModified)
+	}
+	weather.forecast = forecast
+
+	// the forecast is kept when it wasn't modified
+	notModified, err := weather.fetchWeatherData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notModified != forecast {
+		t.Error("got a new forecast for a not modified response")
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+	if want := time.Date(2024, 6, 1, 0, 40, 0, 0, time.UTC); !weather.expireTimestamp.Equal(want) {
+		t.Errorf("expires %s, want %s", weather.expireTimestamp, want)
+	}
+
+	cache, err := readWeatherCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.LastModified != testLastModified || cache.Body != string(body) {
+		t.Errorf("cached %q with a %d byte body", cache.LastModified, len(cache.Body))
+	}
+}
+
+func TestWeatherFetchRetryAfter(t *testing.T) {
+	weather := newTestWeather(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := weather.fetchWeatherData()
+	var statusErr *weatherStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("got %v, want a status error", err)
+	}
+	if statusErr.statusCode != http.StatusTooManyRequests || statusErr.retryAfter != 10*time.Minute {
+		t.Errorf("got %+v", statusErr)
+	}
+
+	// Retry-After is respected when it is longer than the backoff
+	if delay := weather.retryDelay(err); delay != 10*time.Minute {
+		t.Errorf("delay %s, want 10m", delay)
+	}
+	if weather.backoff != WEATHER_MIN_BACKOFF {
+		t.Errorf("backoff %s, want %s", weather.backoff, WEATHER_MIN_BACKOFF)
+	}
+}
+
+func TestWeatherRetryDelay(t *testing.T) {
+	weather := &Weather{}
+
+	// the backoff doubles up to the maximum
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		delay := weather.retryDelay(&weatherStatusError{statusCode: http.StatusServiceUnavailable})
+		if delay < backoff+30*time.Second || delay >= backoff+150*time.Second {
+			t.Errorf("delay %s, want %s with jitter", delay, backoff)
+		}
+	}
+	weather.backoff = WEATHER_MAX_BACKOFF
+	weather.retryDelay(&weatherStatusError{statusCode: http.StatusBadGateway})
+	if weather.backoff != WEATHER_MAX_BACKOFF {
+		t.Errorf("backoff %s above the maximum", weather.backoff)
+	}
+
+	// other errors are retried at the normal interval
+	for _, err := range []error{&weatherStatusError{statusCode: http.StatusNotFound}, errors.New("timeout")} {
+		if delay := weather.retryDelay(err); delay < WEATHER_DEFAULT_INTERVAL || delay >= WEATHER_DEFAULT_INTERVAL+150*time.Second {
+			t.Errorf("%s: delay %s, want the default interval", err, delay)
+		}
+	}
+}
+
+func TestWeatherCorruptCache(t *testing.T) {
+	weather := newTestWeather(t, http.NotFound)
+
+	req, err := weather.provider.request(weather.location.lat, weather.location.lon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &weatherCache{Url: req.URL.String(), Body: `{"properties": {"timeseries": [{"time": "2024-06-01T00:00:00Z", "data": 1}]}}`}
+	if err := writeWeatherCache(cache); err != nil {
+		t.Fatal(err)
+	}
+
+	weather.setup()
+	if weather.forecast != nil {
+		t.Errorf("got a forecast from a corrupt cache: %+v", weather.forecast)
+	}
+}
+
+// hourlyForecast returns a forecast from an hour ago until two days ahead
+func hourlyForecast(next6Hours bool) *weatherForecast {
+	forecast := &weatherForecast{}
+	start := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for hour := 0; hour < 50; hour++ {
+		data := &weatherData{time: start.Add(time.Duration(hour) * time.Hour), airTemperature: float64(hour % 10), symbolCode: "cloudy"}
+		if next6Hours {
+			data.next6Hours = &weatherPeriod{symbolCode: "rain", minTemperature: 1, maxTemperature: 5}
+		}
+		forecast.timeseries = append(forecast.timeseries, data)
+	}
+	return forecast
+}
+
+func TestWeatherClickCyclesViews(t *testing.T) {
+	widget := NewWeatherWidget(WeatherConfig{})
+	weather := widget.impl.(*Weather)
+	drainUpdates(t, widget)
+
+	weather.forecast = hourlyForecast(true)
+	for _, want := range []weatherView{viewNext6Hours, viewTomorrow, viewCurrent} {
+		weather.onClick(0, 0, 1)
+		if weather.view != want {
+			t.Errorf("view %d, want %d", weather.view, want)
+		}
+	}
+
+	// forecasts the provider doesn't have are skipped
+	weather.forecast = hourlyForecast(false)
+	weather.onClick(0, 0, 1)
+	if weather.view != viewTomorrow {
+		t.Errorf("view %d, want tomorrow without the next 6 hours", weather.view)
+	}
+}
+
+func TestWeatherClickWhileFetching(t *testing.T) {
+	body, err := os.ReadFile("testdata/locationforecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weather := newTestWeather(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+	drainUpdates(t, weather.Widget)
+
+	go weather.run()
+
+	// click until the forecast has been replaced by run
+	for fetched := false; !fetched; {
+		weather.onClick(0, 0, 1)
+
+		weather.block.Lock()
+		fetched = weather.forecast != nil
+		weather.block.Unlock()
+	}
+}
+
+func TestWeatherClickWhileMoving(t *testing.T) {
+	body, err := os.ReadFile("testdata/locationforecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weather := newTestWeather(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+	drainUpdates(t, weather.Widget)
+	// right click opens the browser, which isn't found here
+	t.Setenv("PATH", t.TempDir())
+
+	go weather.run()
+
+	oslo := weatherLocation{lat: 59.91, lon: 10.75}
+	bergen := weatherLocation{lat: 60.39, lon: 5.32}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			weather.locationChannel <- bergen
+		} else {
+			weather.locationChannel <- oslo
+		}
+		weather.onClick(0, 0, 3)
+	}
+}
+
+func TestWeatherPrecipitationCountdown(t *testing.T) {
+	if widget := NewWeatherWidget(WeatherConfig{}); widget.Interval != -1 {
+		t.Errorf("interval %d without a precipitation warning", widget.Interval)
+	}
+
+	// updated every minute, not only after fetching the forecast
+	widget := NewWeatherWidget(WeatherConfig{PrecipitationWarning: 30})
+	if widget.Interval != 60000 {
+		t.Errorf("interval %d, want a minute", widget.Interval)
+	}
+
+	weather := widget.impl.(*Weather)
+	now := time.Now()
+	weather.forecast = &weatherForecast{timeseries: []*weatherData{
+		{time: now.Add(-time.Minute), symbolCode: "cloudy"},
+		{time: now.Add(14*time.Minute + 30*time.Second), precipitationRate: 1.2},
+	}}
+
+	block := &block{}
+	weather.update(block)
+	if want := fmt.Sprintf(" %c 14min", ICON_UMBRELLA); !strings.HasSuffix(block.FullText, want) || !block.Urgent {
+		t.Errorf("got %q urgent %t, want the countdown", block.FullText, block.Urgent)
+	}
+
+	weather.forecast.timeseries[1].time = now.Add(-30 * time.Second)
+	weather.update(block)
+	if strings.Contains(block.FullText, string(ICON_UMBRELLA)) || block.Urgent {
+		t.Errorf("got %q urgent %t after the precipitation started", block.FullText, block.Urgent)
+	}
+}
+
+func TestWeatherClickWhileFetchingAlerts(t *testing.T) {
+	forecast, err := os.ReadFile("testdata/locationforecast.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weather := newTestWeather(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/metalerts/") {
+			w.Write([]byte(`{"features": [{"properties": {"event": "wind", "awareness_level": "2; yellow; Moderate", "web": "http://localhost/alert"}}]}`))
+		} else {
+			w.Write(forecast)
+		}
+	})
+	weather.config.Alerts = true
+	weather.alertsBaseUrl = weather.provider.(*metNoProvider).baseUrl
+	drainUpdates(t, weather.Widget)
+	// right click opens the browser, which isn't found here
+	t.Setenv("PATH", t.TempDir())
+
+	go weather.run()
+
+	for fetched := false; !fetched; {
+		weather.onClick(0, 0, 3)
+
+		weather.block.Lock()
+		fetched = len(weather.alerts) > 0
+		weather.block.Unlock()
+	}
+
+	block := &block{}
+	weather.block.Lock()
+	weather.update(block)
+	weather.block.Unlock()
+	if !strings.HasSuffix(block.FullText, fmt.Sprintf(" %c wind", ICON_ALERT)) || block.Color != COLOR_WARNING {
+		t.Errorf("got %q color %q, want the alert", block.FullText, block.Color)
+	}
+}
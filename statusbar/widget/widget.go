@@ -1,12 +1,18 @@
 package widget
 
 import (
+	"fmt"
 	"log"
 	"sync"
 
 	"github.com/goccy/go-json"
 )
 
+// text colors for widgets crossing a warning threshold. crossing the critical
+// threshold sets the block as urgent instead
+const COLOR_WARNING = "#ebcb8b"
+const COLOR_GOOD = "#a3be8c"
+
 // Update is a signal sent to the update queue to update a widget
 type Update struct {
 	Widget *Widget
@@ -30,6 +36,7 @@ type block struct {
 	Urgent         bool   `json:"urgent,omitempty"`
 	Separator      bool   `json:"separator,omitempty"`
 	SeparatorWidth int    `json:"separator_block_width,omitempty"`
+	Markup         string `json:"markup,omitempty"`
 }
 
 func (b *block) json() string {
@@ -41,6 +48,17 @@ func (b *block) json() string {
 	}
 }
 
+// Visibility decides which outputs a widget is shown on when the statusbar
+// is attached to a bar id
+type Visibility int
+
+const (
+	// shown on every output of the bar
+	VisibleAlways Visibility = iota
+	// shown only while the focused output belongs to the bar
+	VisibleFocusedOutput
+)
+
 type impl interface {
 	setup()
 	close()
@@ -49,6 +67,11 @@ type impl interface {
 	onClick(int, int, int)
 }
 
+// commander is implemented by widgets that take commands over the control socket
+type commander interface {
+	onCommand(args []string) (string, error)
+}
+
 type Widget struct {
 	impl impl
 
@@ -59,6 +82,10 @@ type Widget struct {
 	// signal an update explicitly (via the Update method)
 	Interval int
 
+	// Visibility is the per-output visibility rule, only used when
+	// the statusbar knows its bar id
+	Visibility Visibility
+
 	// current state
 	block *block
 
@@ -103,6 +130,14 @@ func (w *Widget) OnClick(x int, y int, btn int) {
 	w.impl.onClick(x, y, btn)
 }
 
+// OnCommand passes a command from the control socket to the widget, and returns the reply
+func (w *Widget) OnCommand(args []string) (string, error) {
+	if commander, ok := w.impl.(commander); ok {
+		return commander.onCommand(args)
+	}
+	return "", fmt.Errorf("widget %s takes no commands", w.Name)
+}
+
 // sendUpdate is a helper function to signal an update for the widget
 func (w *Widget) sendUpdate() {
 	w.queue <- []*Update{w.Update()}
@@ -27,12 +27,16 @@ type WindowTitle struct {
 }
 
 func NewWindowTitleWidget() *Widget {
-	return newWidget("window_title", -1, func(widget *Widget) impl {
+	w := newWidget("window_title", -1, func(widget *Widget) impl {
 		return &WindowTitle{
 			Widget:            widget,
 			processNamesByPid: make(map[int]string),
 		}
 	})
+
+	// the focused window only makes sense on the focused output
+	w.Visibility = VisibleFocusedOutput
+	return w
 }
 
 func (w *WindowTitle) setup() {
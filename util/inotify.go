@@ -0,0 +1,48 @@
+package util
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// WatchFiles sends to the channel every time one of the files is modified.
+// blocks until the watch fails. pending notifications are not queued, so a
+// slow receiver only sees one notification for a burst of changes
+func WatchFiles(paths []string, changed chan<- struct{}) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	defer syscall.Close(fd)
+
+	for _, path := range paths {
+		if _, err := syscall.InotifyAddWatch(fd, path, syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE); err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+	}
+
+	buf := make([]byte, (syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)*16)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return os.NewSyscallError("read", err)
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				// the file was removed
+				return os.ErrNotExist
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
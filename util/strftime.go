@@ -0,0 +1,113 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Strftime formats a time with the C strftime conversions, which unlike Go
+// layouts also cover week numbers and the day of the year
+func Strftime(format string, t time.Time) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			sb.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'D':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'e':
+			fmt.Fprintf(&sb, "%2d", t.Day())
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'G':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&sb, "%d", year)
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&sb, "%02d", hour12(t))
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&sb, "%2d", hour12(t))
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 'n':
+			sb.WriteByte('\n')
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'P':
+			sb.WriteString(t.Format("pm"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'S':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 't':
+			sb.WriteByte('\t')
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			// monday is 1 and sunday 7
+			weekday := int(t.Weekday())
+			if weekday == 0 {
+				weekday = 7
+			}
+			fmt.Fprintf(&sb, "%d", weekday)
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&sb, "%02d", week)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'y':
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'Y':
+			fmt.Fprintf(&sb, "%d", t.Year())
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			// unknown conversions are left as is
+			sb.WriteByte('%')
+			sb.WriteByte(format[i])
+		}
+	}
+
+	return sb.String()
+}
+
+func hour12(t time.Time) int {
+	hour := t.Hour() % 12
+	if hour == 0 {
+		hour = 12
+	}
+	return hour
+}
@@ -0,0 +1,54 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrftime(t *testing.T) {
+	// a monday in the first ISO week of the next year
+	monday := time.Date(2024, 12, 30, 9, 5, 7, 0, time.FixedZone("CET", 3600))
+	// a sunday just after midnight, and in the afternoon
+	sunday := time.Date(2024, 3, 3, 0, 30, 0, 0, time.UTC)
+	afternoon := time.Date(2024, 3, 3, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		t      time.Time
+		want   string
+	}{
+		{"%a %A", monday, "Mon Monday"},
+		{"%b %h %B", monday, "Dec Dec December"},
+		{"%c", monday, "Mon Dec 30 09:05:07 2024"},
+		{"%C", monday, "20"},
+		{"%d %e", monday, "30 30"},
+		{"%d|%e", sunday, "03| 3"},
+		{"%D", monday, "12/30/24"},
+		{"%F", monday, "2024-12-30"},
+		{"%G W%V", monday, "2025 W01"},
+		{"%G W%V", sunday, "2024 W09"},
+		{"%H %I %k %l", monday, "09 09  9  9"},
+		{"%H %I %k %l %p %P", sunday, "00 12  0 12 AM am"},
+		{"%I %l %p %P", afternoon, "01  1 PM pm"},
+		{"%j", monday, "365"},
+		{"%j", sunday, "063"},
+		{"%m %M %S", monday, "12 05 07"},
+		{"%n%t", monday, "\n\t"},
+		{"%R %T", monday, "09:05 09:05:07"},
+		{"%s", monday, "1735545907"},
+		{"%u %w", monday, "1 1"},
+		{"%u %w", sunday, "7 0"},
+		{"%y %Y", monday, "24 2024"},
+		{"%z %Z", monday, "+0100 CET"},
+		{"100%%", monday, "100%"},
+		// unknown conversions and a trailing % are left as is
+		{"%q %", monday, "%q %"},
+		{"week {week}", monday, "week {week}"},
+	}
+
+	for _, test := range tests {
+		if got := Strftime(test.format, test.t); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
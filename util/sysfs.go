@@ -0,0 +1,25 @@
+package util
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadFileString reads a small file such as a sysfs attribute, without the trailing newline
+func ReadFileString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ReadFileInt reads a small file containing a single integer
+func ReadFileInt(path string) (int64, error) {
+	str, err := ReadFileString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(str, 10, 64)
+}
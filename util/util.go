@@ -1,7 +1,9 @@
 package util
 
 import (
+	"fmt"
 	"os/exec"
+	"strings"
 )
 
 func Sum(a []int) int {
@@ -18,3 +20,50 @@ func OpenBrowser(url string) error {
 	}
 	return nil
 }
+
+func CopyToClipboard(text string) error {
+	cmd := exec.Command("wl-copy")
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Notify shows a desktop notification with notify-send
+func Notify(summary string, body string) error {
+	return exec.Command("notify-send", "--app-name=statusbar", summary, body).Run()
+}
+
+// RunLauncher shows the options in a dmenu style launcher such as wofi --dmenu or
+// fuzzel --dmenu, and returns the chosen one. options are passed one per line on
+// stdin, and the choice is read from stdout
+func RunLauncher(launcher []string, options []string) (string, error) {
+	if len(launcher) == 0 {
+		return "", fmt.Errorf("no launcher configured")
+	}
+
+	cmd := exec.Command(launcher[0], launcher[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(options, "\n"))
+	stdout, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// FormatBytes formats a byte count with binary units, e.g. 1.5G
+func FormatBytes(bytes float64) string {
+	units := []string{"B", "K", "M", "G", "T", "P"}
+
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+
+	if bytes < 10 && unit > 0 {
+		return fmt.Sprintf("%.1f%s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.0f%s", bytes, units[unit])
+}